@@ -20,6 +20,8 @@ type TMessageAllArea struct {
 	InternalDate int64 `json:"internalDate,omitempty,string"`
 	// LabelIds: List of IDs of labels applied to this message.
 	LabelIds []string `json:"labelIds,omitempty"`
+	// LabelNames: Names of the labels applied to this message, nested labels as paths.
+	LabelNames []string `json:"labelNames,omitempty"`
 	// SizeEstimate: Estimated size in bytes of the message.
 	SizeEstimate int64 `json:"sizeEstimate,omitempty"`
 	// Snippet: A short part of the message text.
@@ -31,6 +33,8 @@ type TMessageAllArea struct {
 	// in compliance with the RFC 2822 (https://tools.ietf.org/html/rfc2822)
 	// standard. 3. The `Subject` headers must match.
 	ThreadId string `json:"threadId,omitempty"`
+	// Conversation: The place of the message in the conversation rebuilt from its headers.
+	Conversation *TConversation `json:"conversation,omitempty"`
 	// Headers: Headers of the message.
 	Headers []struct {
 		Name  string `json:"name,omitempty"`
@@ -40,18 +44,32 @@ type TMessageAllArea struct {
 	PlainText string `json:"plainText,omitempty"`
 	// Raw: The entire email message in an RFC 2822 formatted.
 	Raw string `json:"raw,omitempty"`
+	// Redactions: The redaction rules that changed the message, if it was redacted.
+	Redactions []string `json:"redactions,omitempty"`
+}
+
+func init() {
+	mustRegister(TArea{
+		Name:        "all",
+		Description: "everything of easy plus the whole RFC 2822 message",
+		Prepare: func(m *gmail.Message, annotations TAnnotations) (any, error) {
+			return PrepareAllArea(m, annotations)
+		},
+	})
 }
 
 // PrepareAllArea takes a Gmail message and returns a TMessageAllArea structure with the fields populated.
-func PrepareAllArea(m *gmail.Message) (TMessageAllArea, error) {
+func PrepareAllArea(m *gmail.Message, annotations TAnnotations) (TMessageAllArea, error) {
 	pm := new(TMessageAllArea)
 	var err error
 	pm.Id = m.Id
 	pm.InternalDate = m.InternalDate
 	pm.LabelIds = m.LabelIds
+	pm.LabelNames = annotations.LabelNames
 	pm.SizeEstimate = m.SizeEstimate
 	pm.Snippet = m.Snippet
 	pm.ThreadId = m.ThreadId
+	pm.Conversation = annotations.Conversation
 	pm.Headers = make([]struct {
 		Name  string `json:"name,omitempty"`
 		Value string `json:"value,omitempty"`
@@ -98,9 +116,19 @@ func (Ma TMessageAllArea) String() string {
 		St = St + fmt.Sprintf("%s, ", label)
 	}
 	St = St + fmt.Sprintf("%s\r\n", "")
+	if len(Ma.LabelNames) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Label Names")
+		for _, label := range Ma.LabelNames {
+			St = St + fmt.Sprintf("%s, ", label)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
 	St = St + fmt.Sprintf("%s: %v\r\n", "Size Estimate", Ma.SizeEstimate)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Snippet", Ma.Snippet)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Thread ID", Ma.ThreadId)
+	if Ma.Conversation != nil {
+		St = St + Ma.Conversation.String()
+	}
 	St = St + fmt.Sprintf("%s\r\n", "--- Headers ---")
 	for _, keyHeader := range Ma.Headers {
 		St = St + fmt.Sprintf("%s: %s\r\n", keyHeader.Name, keyHeader.Value)
@@ -108,6 +136,13 @@ func (Ma TMessageAllArea) String() string {
 	St = St + fmt.Sprintf("%s\r\n%s\r\n", "--- Plain Text ---", Ma.PlainText)
 	St = St + fmt.Sprintf("%s\r\n", "--- Raw Body ---")
 	St = St + fmt.Sprintf("%s\r\n", Ma.Raw)
+	if len(Ma.Redactions) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Redactions")
+		for _, rule := range Ma.Redactions {
+			St = St + fmt.Sprintf("%s, ", rule)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
 	return St
 }
 
@@ -119,6 +154,6 @@ func (Ma TMessageAllArea) ToJson() ([]byte, error) {
 
 // ToTxt method converts the TMessageAllArea structure to a plain text byte array.
 func (Ma TMessageAllArea) ToTxt() ([]byte, error) {
-	b := []byte(fmt.Sprintf("%+v", Ma))
+	b := []byte(Ma.String())
 	return b, nil
 }
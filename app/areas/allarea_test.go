@@ -36,7 +36,7 @@ func TestPrepareAllArea(t *testing.T) {
 	}
 
 	// Call the function
-	result, err := PrepareAllArea(message)
+	result, err := PrepareAllArea(message, TAnnotations{})
 
 	// Check no error occurred
 	require.NoError(t, err)
@@ -0,0 +1,62 @@
+package areas
+
+import "fmt"
+
+// TAnnotations holds information about a message that Gmail does not return with the message itself
+type TAnnotations struct {
+	// LabelNames: Names of the labels applied to the message, in the order of LabelIds.
+	// Names of nested labels are paths such as "Work/Clients".
+	LabelNames []string
+	// Conversation: The place of the message in the conversation rebuilt from its headers, if requested.
+	Conversation *TConversation
+}
+
+// TConversation describes the place of a message in a conversation tree rebuilt from the
+// Message-ID, In-Reply-To and References headers
+type TConversation struct {
+	// ParentId: The Gmail ID of the message this message replies to, if it was exported.
+	ParentId string `json:"parentId,omitempty"`
+	// ParentMessageId: The Message-ID header of the message this message replies to.
+	ParentMessageId string `json:"parentMessageId,omitempty"`
+	// RootMessageId: The Message-ID header of the first message of the conversation.
+	RootMessageId string `json:"rootMessageId,omitempty"`
+	// Depth: The number of levels above this message in the tree; 0 for the first message.
+	// Messages that were referenced but not exported are left out, except a missing first message
+	// that joins several replies into one conversation.
+	Depth int `json:"depth"`
+	// Tree: The rendering of the conversation tree, one line per message, used by the txt format.
+	Tree []string `json:"-"`
+}
+
+// String method returns a formatted string representation of TConversation
+func (c TConversation) String() string {
+	St := ""
+	St = St + fmt.Sprintf("%s\r\n", "--- Conversation ---")
+	St = St + fmt.Sprintf("%s: %s\r\n", "Parent ID", c.ParentId)
+	St = St + fmt.Sprintf("%s: %s\r\n", "Parent Message-ID", c.ParentMessageId)
+	St = St + fmt.Sprintf("%s: %s\r\n", "Root Message-ID", c.RootMessageId)
+	St = St + fmt.Sprintf("%s: %v\r\n", "Depth", c.Depth)
+	for _, line := range c.Tree {
+		St = St + fmt.Sprintf("%s\r\n", line)
+	}
+	return St
+}
+
+// TLabels maps label IDs to label names
+type TLabels map[string]string
+
+// Names returns the names of the labels with the IDs. Unknown IDs are returned as they are.
+func (labels TLabels) Names(ids []string) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		name, ok := labels[id]
+		if !ok {
+			name = id
+		}
+		names[i] = name
+	}
+	return names
+}
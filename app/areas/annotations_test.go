@@ -0,0 +1,13 @@
+package areas
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelsNames(t *testing.T) {
+	labels := TLabels{"INBOX": "INBOX", "Label_1": "Work/Clients"}
+	assert.Equal(t, []string{"Work/Clients", "INBOX", "Label_2"}, labels.Names([]string{"Label_1", "INBOX", "Label_2"}))
+	assert.Nil(t, labels.Names(nil))
+}
@@ -0,0 +1,332 @@
+package areas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Sources are the values a custom area can select, besides "header:<Name>" for the first
+// header with the name
+var Sources = []string{
+	"id", "threadId", "historyId", "internalDate", "labelIds", "labelNames", "sizeEstimate", "snippet",
+	"conversation", "headers", "body:text", "body:html", "attachments", "raw",
+}
+
+// TField selects a value of the message for a custom area and names it in the output
+type TField struct {
+	// Key: The name of the value in the output.
+	Key string
+	// Source: One of Sources, or "header:<Name>".
+	Source string
+}
+
+// TAreaDefinition declares an area by the fields it selects
+type TAreaDefinition struct {
+	Name   string
+	Fields []TField
+}
+
+// ParseFields parses a comma-separated list of fields, each a source or "key=source",
+// e.g. "id,date=internalDate,header:Subject,body=body:text".
+// Without a key, a header is named after it in lower camel case (Message-ID gives messageId),
+// body:text is named plainText and body:html html.
+func ParseFields(spec string) ([]TField, error) {
+	var fields []TField
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		field := TField{Source: item}
+		if key, source, ok := strings.Cut(item, "="); ok {
+			field = TField{Key: strings.TrimSpace(key), Source: strings.TrimSpace(source)}
+		}
+		if !validSource(field.Source) {
+			return nil, fmt.Errorf("unknown field source %q, the sources are %s and header:<Name>", field.Source, strings.Join(Sources, ", "))
+		}
+		if field.Key == "" {
+			field.Key = defaultKey(field.Source)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields")
+	}
+	return fields, nil
+}
+
+func validSource(source string) bool {
+	if name, ok := strings.CutPrefix(source, "header:"); ok {
+		return name != ""
+	}
+	for _, s := range Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultKey returns the output name of a field given without a key
+func defaultKey(source string) string {
+	switch source {
+	case "body:text":
+		return "plainText"
+	case "body:html":
+		return "html"
+	}
+	name, ok := strings.CutPrefix(source, "header:")
+	if !ok {
+		return source
+	}
+	words := strings.Split(name, "-")
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if i > 0 && w != "" {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		words[i] = w
+	}
+	return strings.Join(words, "")
+}
+
+// Define registers a custom area, which is then selected by its name like the built-in areas
+func Define(definition TAreaDefinition) error {
+	if len(definition.Fields) == 0 {
+		return fmt.Errorf("area %q has no fields", definition.Name)
+	}
+	keys := make([]string, len(definition.Fields))
+	for i, f := range definition.Fields {
+		keys[i] = f.Key
+		if f.Key != f.Source {
+			keys[i] = f.Key + "=" + f.Source
+		}
+	}
+	return Register(TArea{
+		Name:        definition.Name,
+		Description: "custom area: " + strings.Join(keys, ","),
+		Fields:      definition.Fields,
+		Prepare: func(m *gmail.Message, annotations TAnnotations) (any, error) {
+			return PrepareCustomArea(definition, m, annotations)
+		},
+	})
+}
+
+// TFieldValue is a value of a custom area
+type TFieldValue struct {
+	Key   string
+	Value any
+	// source is the source of the value, which tells how it is redacted
+	source string
+}
+
+// THeader is a header of a custom area
+type THeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// TAttachment describes an attached file of a custom area
+type TAttachment struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+// TMessageCustomArea holds the values selected by a custom area, in the order of its fields
+type TMessageCustomArea struct {
+	Fields []TFieldValue
+}
+
+// PrepareCustomArea takes a Gmail message and returns the values selected by the definition.
+func PrepareCustomArea(definition TAreaDefinition, m *gmail.Message, annotations TAnnotations) (TMessageCustomArea, error) {
+	pm := TMessageCustomArea{Fields: make([]TFieldValue, len(definition.Fields))}
+	for i, field := range definition.Fields {
+		value, err := fieldValue(field.Source, m, annotations)
+		if err != nil {
+			return pm, err
+		}
+		pm.Fields[i] = TFieldValue{Key: field.Key, Value: value, source: field.Source}
+	}
+	return pm, nil
+}
+
+// fieldValue returns the value of the source in the message
+func fieldValue(source string, m *gmail.Message, annotations TAnnotations) (any, error) {
+	if name, ok := strings.CutPrefix(source, "header:"); ok {
+		if m.Payload != nil {
+			for _, h := range m.Payload.Headers {
+				if strings.EqualFold(h.Name, name) {
+					return h.Value, nil
+				}
+			}
+		}
+		return "", nil
+	}
+	switch source {
+	case "id":
+		return m.Id, nil
+	case "threadId":
+		return m.ThreadId, nil
+	case "historyId":
+		return m.HistoryId, nil
+	case "internalDate":
+		// A string like in the built-in areas
+		return strconv.FormatInt(m.InternalDate, 10), nil
+	case "labelIds":
+		return m.LabelIds, nil
+	case "labelNames":
+		return annotations.LabelNames, nil
+	case "sizeEstimate":
+		return m.SizeEstimate, nil
+	case "snippet":
+		return m.Snippet, nil
+	case "conversation":
+		return annotations.Conversation, nil
+	case "headers":
+		var headers []THeader
+		if m.Payload != nil {
+			for _, h := range m.Payload.Headers {
+				headers = append(headers, THeader{Name: h.Name, Value: h.Value})
+			}
+		}
+		return headers, nil
+	case "body:text":
+		return decodedBody(m.Payload, "text/plain")
+	case "body:html":
+		return decodedBody(m.Payload, "text/html")
+	case "attachments":
+		return attachments(m.Payload, nil), nil
+	case "raw":
+		raw, err := base64.URLEncoding.DecodeString(m.Raw)
+		return string(raw), err
+	}
+	return nil, fmt.Errorf("unknown field source %q", source)
+}
+
+// decodedBody returns the decoded first part of the message with the MIME type
+func decodedBody(part *gmail.MessagePart, mimeType string) (string, error) {
+	if part == nil {
+		return "", nil
+	}
+	if part.MimeType == mimeType && part.Filename == "" && part.Body != nil {
+		b, err := base64.URLEncoding.DecodeString(part.Body.Data)
+		return string(b), err
+	}
+	for _, p := range part.Parts {
+		body, err := decodedBody(p, mimeType)
+		if body != "" || err != nil {
+			return body, err
+		}
+	}
+	return "", nil
+}
+
+// attachments appends the parts with a file name to the list
+func attachments(part *gmail.MessagePart, list []TAttachment) []TAttachment {
+	if part == nil {
+		return list
+	}
+	if part.Filename != "" {
+		attachment := TAttachment{Filename: part.Filename, MimeType: part.MimeType}
+		if part.Body != nil {
+			attachment.Size = part.Body.Size
+		}
+		list = append(list, attachment)
+	}
+	for _, p := range part.Parts {
+		list = attachments(p, list)
+	}
+	return list
+}
+
+// Get returns the value with the key, for templates: {{.Get "subject"}}
+func (Ma TMessageCustomArea) Get(key string) any {
+	for _, f := range Ma.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the values as an object with the keys in the order of the fields
+func (Ma TMessageCustomArea) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range Ma.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// String method returns a formatted string representation of TMessageCustomArea
+func (Ma TMessageCustomArea) String() string {
+	St := ""
+	for _, f := range Ma.Fields {
+		switch v := f.Value.(type) {
+		case []string:
+			St = St + fmt.Sprintf("%s: ", f.Key)
+			for _, s := range v {
+				St = St + fmt.Sprintf("%s, ", s)
+			}
+			St = St + fmt.Sprintf("%s\r\n", "")
+		case []THeader:
+			St = St + fmt.Sprintf("--- %s ---\r\n", f.Key)
+			for _, h := range v {
+				St = St + fmt.Sprintf("%s: %s\r\n", h.Name, h.Value)
+			}
+		case []TAttachment:
+			St = St + fmt.Sprintf("--- %s ---\r\n", f.Key)
+			for _, a := range v {
+				St = St + fmt.Sprintf("%s (%s, %v bytes)\r\n", a.Filename, a.MimeType, a.Size)
+			}
+		case *TConversation:
+			if v != nil {
+				St = St + v.String()
+			}
+		case string:
+			if strings.Contains(v, "\n") {
+				St = St + fmt.Sprintf("--- %s ---\r\n", f.Key)
+				St = St + fmt.Sprintf("%s\r\n", v)
+			} else {
+				St = St + fmt.Sprintf("%s: %s\r\n", f.Key, v)
+			}
+		default:
+			St = St + fmt.Sprintf("%s: %v\r\n", f.Key, v)
+		}
+	}
+	return St
+}
+
+// ToJson method converts the TMessageCustomArea structure to a JSON byte array.
+func (Ma TMessageCustomArea) ToJson() ([]byte, error) {
+	b, err := json.Marshal(Ma)
+	return b, err
+}
+
+// ToTxt method converts the TMessageCustomArea structure to a plain text byte array.
+func (Ma TMessageCustomArea) ToTxt() ([]byte, error) {
+	b := []byte(Ma.String())
+	return b, nil
+}
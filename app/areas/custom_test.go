@@ -0,0 +1,73 @@
+package areas
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("id, date=internalDate,header:Message-ID,body:text")
+	require.NoError(t, err)
+	assert.Equal(t, []TField{
+		{Key: "id", Source: "id"},
+		{Key: "date", Source: "internalDate"},
+		{Key: "messageId", Source: "header:Message-ID"},
+		{Key: "plainText", Source: "body:text"},
+	}, fields)
+
+	_, err = ParseFields("id,body")
+	assert.ErrorContains(t, err, `unknown field source "body"`)
+	_, err = ParseFields(" , ")
+	assert.Error(t, err)
+}
+
+func TestDefine(t *testing.T) {
+	assert.ErrorContains(t, Define(TAreaDefinition{Name: "small", Fields: []TField{{Key: "id", Source: "id"}}}), "built in")
+	assert.Error(t, Define(TAreaDefinition{Name: "empty"}))
+
+	require.NoError(t, Define(TAreaDefinition{Name: "brief", Fields: []TField{{Key: "id", Source: "id"}}}))
+	area, ok := Lookup("brief")
+	assert.True(t, ok)
+	assert.Equal(t, "custom area: id", area.Description)
+	assert.Contains(t, Names(), "brief")
+}
+
+func TestPrepareCustomArea(t *testing.T) {
+	message := &gmail.Message{
+		Id:           "12345",
+		InternalDate: 1620000000000,
+		LabelIds:     []string{"INBOX"},
+		Payload: &gmail.MessagePart{
+			MimeType: "multipart/mixed",
+			Headers: []*gmail.MessagePartHeader{
+				{Name: "Subject", Value: "Test Email"},
+				{Name: "Reply-To", Value: "reply@example.com"},
+			},
+			Parts: []*gmail.MessagePart{
+				{MimeType: "text/plain", Body: &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte("Hello,\r\nworld"))}},
+				{MimeType: "application/pdf", Filename: "a.pdf", Body: &gmail.MessagePartBody{Size: 3}},
+			},
+		},
+	}
+	fields, err := ParseFields("subject=header:Subject,header:Reply-To,id,date=internalDate,labelNames,body:text,attachments")
+	require.NoError(t, err)
+
+	result, err := PrepareCustomArea(TAreaDefinition{Name: "custom", Fields: fields}, message, TAnnotations{LabelNames: []string{"Inbox"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Test Email", result.Get("subject"))
+	assert.Nil(t, result.Get("missing"))
+
+	b, err := result.ToJson()
+	require.NoError(t, err)
+	assert.Equal(t, `{"subject":"Test Email","replyTo":"reply@example.com","id":"12345","date":"1620000000000",`+
+		`"labelNames":["Inbox"],"plainText":"Hello,\r\nworld","attachments":[{"filename":"a.pdf","mimeType":"application/pdf","size":3}]}`, string(b))
+
+	txt, err := result.ToTxt()
+	require.NoError(t, err)
+	assert.Equal(t, "subject: Test Email\r\nreplyTo: reply@example.com\r\nid: 12345\r\ndate: 1620000000000\r\nlabelNames: Inbox, \r\n"+
+		"--- plainText ---\r\nHello,\r\nworld\r\n--- attachments ---\r\na.pdf (application/pdf, 3 bytes)\r\n", string(txt))
+}
@@ -35,7 +35,7 @@ func TestPrepareEasyArea(t *testing.T) {
 	}
 
 	// Call the function
-	result, err := PrepareEasyArea(message)
+	result, err := PrepareEasyArea(message, TAnnotations{})
 
 	// Check no error occurred
 	require.NoError(t, err)
@@ -20,6 +20,8 @@ type TMessageRawArea struct {
 	InternalDate int64 `json:"internalDate,omitempty,string"`
 	// LabelIds: List of IDs of labels applied to this message.
 	LabelIds []string `json:"labelIds,omitempty"`
+	// LabelNames: Names of the labels applied to this message, nested labels as paths.
+	LabelNames []string `json:"labelNames,omitempty"`
 	// SizeEstimate: Estimated size in bytes of the message.
 	SizeEstimate int64 `json:"sizeEstimate,omitempty"`
 	// Snippet: A short part of the message text.
@@ -31,19 +33,35 @@ type TMessageRawArea struct {
 	// in compliance with the RFC 2822 (https://tools.ietf.org/html/rfc2822)
 	// standard. 3. The `Subject` headers must match.
 	ThreadId string `json:"threadId,omitempty"`
+	// Conversation: The place of the message in the conversation rebuilt from its headers.
+	Conversation *TConversation `json:"conversation,omitempty"`
 	// Raw: The entire email message in an RFC 2822 formatted.
 	Raw string `json:"raw,omitempty"`
+	// Redactions: The redaction rules that changed the message, if it was redacted.
+	Redactions []string `json:"redactions,omitempty"`
+}
+
+func init() {
+	mustRegister(TArea{
+		Name:        "raw",
+		Description: "Gmail ID, thread, labels, dates, size, snippet and the whole RFC 2822 message",
+		Prepare: func(m *gmail.Message, annotations TAnnotations) (any, error) {
+			return PrepareRawArea(m, annotations)
+		},
+	})
 }
 
 // PrepareAllArea takes a Gmail message and returns a TMessageRawArea structure with the fields populated.
-func PrepareRawArea(m *gmail.Message) (TMessageRawArea, error) {
+func PrepareRawArea(m *gmail.Message, annotations TAnnotations) (TMessageRawArea, error) {
 	pm := new(TMessageRawArea)
 	pm.Id = m.Id
 	pm.InternalDate = m.InternalDate
 	pm.LabelIds = m.LabelIds
+	pm.LabelNames = annotations.LabelNames
 	pm.SizeEstimate = m.SizeEstimate
 	pm.Snippet = m.Snippet
 	pm.ThreadId = m.ThreadId
+	pm.Conversation = annotations.Conversation
 
 	raw, err := base64.URLEncoding.DecodeString(m.Raw)
 	if err != nil {
@@ -63,11 +81,28 @@ func (Ma TMessageRawArea) String() string {
 		St = St + fmt.Sprintf("%s, ", label)
 	}
 	St = St + fmt.Sprintf("%s\r\n", "")
+	if len(Ma.LabelNames) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Label Names")
+		for _, label := range Ma.LabelNames {
+			St = St + fmt.Sprintf("%s, ", label)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
 	St = St + fmt.Sprintf("%s: %v\r\n", "Size Estimate", Ma.SizeEstimate)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Snippet", Ma.Snippet)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Thread ID", Ma.ThreadId)
+	if Ma.Conversation != nil {
+		St = St + Ma.Conversation.String()
+	}
 	St = St + fmt.Sprintf("%s:\r\n", "--- Raw Body ---")
 	St = St + fmt.Sprintf("%s\r\n", Ma.Raw)
+	if len(Ma.Redactions) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Redactions")
+		for _, rule := range Ma.Redactions {
+			St = St + fmt.Sprintf("%s, ", rule)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
 	return St
 }
 
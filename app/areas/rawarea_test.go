@@ -22,7 +22,7 @@ func TestPrepareRawArea(t *testing.T) {
 	}
 
 	// Call the function
-	result, err := PrepareRawArea(message)
+	result, err := PrepareRawArea(message, TAnnotations{})
 
 	// Check no error occurred
 	require.NoError(t, err)
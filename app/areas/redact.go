@@ -0,0 +1,138 @@
+package areas
+
+import (
+	"gmailexport/app/redact"
+	"strings"
+)
+
+// IRedactable is a prepared message that can be redacted
+type IRedactable interface {
+	// Redact returns a copy of the prepared message redacted in the session, with the rules that fired.
+	Redact(s *redact.TSession) any
+}
+
+// tHeaders is the type of the headers of the easy and all areas
+type tHeaders = []struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// redactHeaders returns the headers without the dropped ones and with the other values redacted
+func redactHeaders(s *redact.TSession, headers tHeaders) tHeaders {
+	var redacted tHeaders
+	for _, h := range headers {
+		value, keep := s.Header(h.Name, h.Value)
+		if keep {
+			h.Value = value
+			redacted = append(redacted, h)
+		}
+	}
+	return redacted
+}
+
+// redactHeader returns the redacted value of a header, "" if the header is dropped
+func redactHeader(s *redact.TSession, name, value string) string {
+	if value == "" {
+		return ""
+	}
+	value, _ = s.Header(name, value)
+	return value
+}
+
+// redactConversation returns a copy of the conversation with its Message-IDs redacted like the
+// Message-ID header, and its tree like a text
+func redactConversation(s *redact.TSession, c *TConversation) *TConversation {
+	if c == nil {
+		return nil
+	}
+	redacted := *c
+	redacted.ParentMessageId = redactHeader(s, "Message-ID", c.ParentMessageId)
+	redacted.RootMessageId = redactHeader(s, "Message-ID", c.RootMessageId)
+	redacted.Tree = make([]string, len(c.Tree))
+	for i, line := range c.Tree {
+		redacted.Tree[i] = s.Text(line)
+	}
+	return &redacted
+}
+
+// Redact returns the message with its snippet and raw message redacted
+func (Ma TMessageRawArea) Redact(s *redact.TSession) any {
+	Ma.Snippet = s.Text(Ma.Snippet)
+	Ma.Conversation = redactConversation(s, Ma.Conversation)
+	Ma.Raw = s.Raw(Ma.Raw)
+	Ma.Redactions = s.Fired()
+	return Ma
+}
+
+// Redact returns the message with its headers, snippet and plain text redacted
+func (Ma TMessageSmallArea) Redact(s *redact.TSession) any {
+	Ma.Snippet = s.Text(Ma.Snippet)
+	Ma.Conversation = redactConversation(s, Ma.Conversation)
+	Ma.MessageId = redactHeader(s, "Message-ID", Ma.MessageId)
+	Ma.Date = redactHeader(s, "Date", Ma.Date)
+	Ma.From = redactHeader(s, "From", Ma.From)
+	Ma.To = redactHeader(s, "To", Ma.To)
+	Ma.Subject = redactHeader(s, "Subject", Ma.Subject)
+	Ma.PlainText = s.Text(Ma.PlainText)
+	Ma.Redactions = s.Fired()
+	return Ma
+}
+
+// Redact returns the message with its headers, snippet and plain text redacted
+func (Ma TMessageEasyArea) Redact(s *redact.TSession) any {
+	Ma.Snippet = s.Text(Ma.Snippet)
+	Ma.Conversation = redactConversation(s, Ma.Conversation)
+	Ma.Headers = redactHeaders(s, Ma.Headers)
+	Ma.PlainText = s.Text(Ma.PlainText)
+	Ma.Redactions = s.Fired()
+	return Ma
+}
+
+// Redact returns the message with its headers, snippet, plain text and raw message redacted
+func (Ma TMessageAllArea) Redact(s *redact.TSession) any {
+	Ma.Snippet = s.Text(Ma.Snippet)
+	Ma.Conversation = redactConversation(s, Ma.Conversation)
+	Ma.Headers = redactHeaders(s, Ma.Headers)
+	Ma.PlainText = s.Text(Ma.PlainText)
+	Ma.Raw = s.Raw(Ma.Raw)
+	Ma.Redactions = s.Fired()
+	return Ma
+}
+
+// Redact returns the values redacted according to their sources, followed by the redactions
+// if any rule fired. The values of dropped headers are left out.
+func (Ma TMessageCustomArea) Redact(s *redact.TSession) any {
+	redacted := TMessageCustomArea{}
+	for _, f := range Ma.Fields {
+		switch value := f.Value.(type) {
+		case string:
+			if name, ok := strings.CutPrefix(f.source, "header:"); ok {
+				v, keep := s.Header(name, value)
+				if !keep {
+					continue
+				}
+				f.Value = v
+			} else if f.source == "raw" {
+				f.Value = s.Raw(value)
+			} else if f.source == "snippet" || strings.HasPrefix(f.source, "body:") {
+				f.Value = s.Text(value)
+			}
+		case []THeader:
+			var headers []THeader
+			for _, h := range value {
+				v, keep := s.Header(h.Name, h.Value)
+				if keep {
+					headers = append(headers, THeader{Name: h.Name, Value: v})
+				}
+			}
+			f.Value = headers
+		case *TConversation:
+			f.Value = redactConversation(s, value)
+		}
+		redacted.Fields = append(redacted.Fields, f)
+	}
+	if fired := s.Fired(); fired != nil {
+		redacted.Fields = append(redacted.Fields, TFieldValue{Key: "redactions", Value: fired})
+	}
+	return redacted
+}
@@ -0,0 +1,46 @@
+package areas
+
+import (
+	"gmailexport/app/redact"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestRedactCustomArea(t *testing.T) {
+	message := &gmail.Message{
+		Id:      "1",
+		Snippet: "Call 0044 20 7946 0958",
+		Payload: &gmail.MessagePart{Headers: []*gmail.MessagePartHeader{
+			{Name: "From", Value: "Alice <alice@example.com>"},
+			{Name: "Received", Value: "from mx"},
+		}},
+	}
+	fields, err := ParseFields("id,header:From,header:Received,snippet")
+	require.NoError(t, err)
+	prepared, err := PrepareCustomArea(TAreaDefinition{Name: "custom", Fields: fields}, message, TAnnotations{})
+	require.NoError(t, err)
+	r, err := redact.New(redact.TConfig{DropHeaders: []string{"Received"}, MaskEmails: true, Rules: []string{"phone"}})
+	require.NoError(t, err)
+
+	b, err := prepared.Redact(r.Session()).(TMessageCustomArea).ToJson()
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"1","from":"***@example.com","snippet":"Call [phone]","redactions":["drop:Received","email","phone"]}`, string(b))
+}
+
+func TestRedactConversation(t *testing.T) {
+	r, err := redact.New(redact.DefaultConfig)
+	require.NoError(t, err)
+
+	c := redactConversation(r.Session(), &TConversation{
+		ParentMessageId: "<2@mail.gmail.com>",
+		RootMessageId:   "<1@mail.gmail.com>",
+		Depth:           1,
+		Tree:            []string{"  Hi (alice@example.com)", "> └─ Re: Hi (bob@example.org)"},
+	})
+	assert.Equal(t, "<2@mail.gmail.com>", c.ParentMessageId)
+	assert.Equal(t, "<1@mail.gmail.com>", c.RootMessageId)
+	assert.Equal(t, []string{"  Hi (***@example.com)", "> └─ Re: Hi (***@example.org)"}, c.Tree)
+}
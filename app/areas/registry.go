@@ -0,0 +1,71 @@
+package areas
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// TArea is an area of the registry: how a Gmail message is prepared for the output.
+// The prepared message is written by every format; json encodes it with encoding/json,
+// txt with its ToTxt method or else its String method.
+type TArea struct {
+	Name        string
+	Description string
+	// Fields: The fields of a custom area, nil for the built-in areas.
+	Fields []TField
+	// Prepare returns the message prepared for the area.
+	Prepare func(m *gmail.Message, annotations TAnnotations) (any, error)
+}
+
+// registry holds the areas by name
+var registry = map[string]TArea{}
+
+// Register adds an area to the registry. A built-in area cannot be replaced.
+func Register(area TArea) error {
+	if area.Name == "" {
+		return fmt.Errorf("area without a name")
+	}
+	if area.Prepare == nil {
+		return fmt.Errorf("area %q cannot prepare messages", area.Name)
+	}
+	if registered, ok := registry[area.Name]; ok && registered.Fields == nil {
+		return fmt.Errorf("area %q is built in", area.Name)
+	}
+	registry[area.Name] = area
+	return nil
+}
+
+// mustRegister registers a built-in area
+func mustRegister(area TArea) {
+	err := Register(area)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the area with the name
+func Lookup(name string) (TArea, bool) {
+	area, ok := registry[name]
+	return area, ok
+}
+
+// Areas returns the registered areas sorted by name
+func Areas() []TArea {
+	list := make([]TArea, 0, len(registry))
+	for _, area := range registry {
+		list = append(list, area)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Names returns the names of the registered areas, sorted
+func Names() []string {
+	var names []string
+	for _, area := range Areas() {
+		names = append(names, area.Name)
+	}
+	return names
+}
@@ -0,0 +1,34 @@
+package areas
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestRegistry(t *testing.T) {
+	assert.Subset(t, Names(), []string{"all", "easy", "raw", "small"})
+
+	small, ok := Lookup("small")
+	require.True(t, ok)
+	prepared, err := small.Prepare(&gmail.Message{Id: "1", Payload: &gmail.MessagePart{}}, TAnnotations{})
+	require.NoError(t, err)
+	assert.Equal(t, "1", prepared.(TMessageSmallArea).Id)
+
+	_, ok = Lookup("missing")
+	assert.False(t, ok)
+}
+
+func TestRegister(t *testing.T) {
+	prepare := func(m *gmail.Message, annotations TAnnotations) (any, error) { return m.Id, nil }
+	assert.ErrorContains(t, Register(TArea{Name: "raw", Prepare: prepare}), "built in")
+	assert.Error(t, Register(TArea{Name: "", Prepare: prepare}))
+	assert.Error(t, Register(TArea{Name: "noprepare"}))
+
+	// A custom area can be defined again
+	fields := []TField{{Key: "id", Source: "id"}}
+	require.NoError(t, Define(TAreaDefinition{Name: "again", Fields: fields}))
+	require.NoError(t, Define(TAreaDefinition{Name: "again", Fields: fields}))
+}
@@ -20,6 +20,8 @@ type TMessageSmallArea struct {
 	InternalDate int64 `json:"internalDate,omitempty,string"`
 	// LabelIds: List of IDs of labels applied to this message.
 	LabelIds []string `json:"labelIds,omitempty"`
+	// LabelNames: Names of the labels applied to this message, nested labels as paths.
+	LabelNames []string `json:"labelNames,omitempty"`
 	// SizeEstimate: Estimated size in bytes of the message.
 	SizeEstimate int64 `json:"sizeEstimate,omitempty"`
 	// Snippet: A short part of the message text.
@@ -31,6 +33,8 @@ type TMessageSmallArea struct {
 	// in compliance with the RFC 2822 (https://tools.ietf.org/html/rfc2822)
 	// standard. 3. The `Subject` headers must match.
 	ThreadId string `json:"threadId,omitempty"`
+	// Conversation: The place of the message in the conversation rebuilt from its headers.
+	Conversation *TConversation `json:"conversation,omitempty"`
 	// Message-ID
 	MessageId string `json:"messageId,omitempty"`
 	// Date
@@ -43,18 +47,32 @@ type TMessageSmallArea struct {
 	Subject string `json:"subject,omitempty"`
 	// PlainText:
 	PlainText string `json:"plainText,omitempty"`
+	// Redactions: The redaction rules that changed the message, if it was redacted.
+	Redactions []string `json:"redactions,omitempty"`
+}
+
+func init() {
+	mustRegister(TArea{
+		Name:        "small",
+		Description: "Gmail ID, thread, labels, dates, size, snippet, Message-ID, From, To, Subject and the plain text body",
+		Prepare: func(m *gmail.Message, annotations TAnnotations) (any, error) {
+			return PrepareSmallArea(m, annotations)
+		},
+	})
 }
 
 // PrepareAllArea takes a Gmail message and returns a TMessageSmallArea structure with the fields populated.
-func PrepareSmallArea(m *gmail.Message) (TMessageSmallArea, error) {
+func PrepareSmallArea(m *gmail.Message, annotations TAnnotations) (TMessageSmallArea, error) {
 	pm := new(TMessageSmallArea)
 	var err error
 	pm.Id = m.Id
 	pm.InternalDate = m.InternalDate
 	pm.LabelIds = m.LabelIds
+	pm.LabelNames = annotations.LabelNames
 	pm.SizeEstimate = m.SizeEstimate
 	pm.Snippet = m.Snippet
 	pm.ThreadId = m.ThreadId
+	pm.Conversation = annotations.Conversation
 	for _, h := range m.Payload.Headers {
 		switch h.Name {
 		case "Message-ID":
@@ -88,9 +106,19 @@ func (Ma TMessageSmallArea) String() string {
 		St = St + fmt.Sprintf("%s, ", label)
 	}
 	St = St + fmt.Sprintf("%s\r\n", "")
+	if len(Ma.LabelNames) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Label Names")
+		for _, label := range Ma.LabelNames {
+			St = St + fmt.Sprintf("%s, ", label)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
 	St = St + fmt.Sprintf("%s: %v\r\n", "Size Estimate", Ma.SizeEstimate)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Snippet", Ma.Snippet)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Thread ID", Ma.ThreadId)
+	if Ma.Conversation != nil {
+		St = St + Ma.Conversation.String()
+	}
 	St = St + fmt.Sprintf("%s\r\n", "--- Headers ---")
 	St = St + fmt.Sprintf("%s: %s\r\n", "Message-ID", Ma.MessageId)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Date", Ma.Date)
@@ -98,6 +126,13 @@ func (Ma TMessageSmallArea) String() string {
 	St = St + fmt.Sprintf("%s: %s\r\n", "To", Ma.To)
 	St = St + fmt.Sprintf("%s: %s\r\n", "Subject", Ma.Subject)
 	St = St + fmt.Sprintf("%s\r\n%s\r\n", "--- Plain Text ---", Ma.PlainText)
+	if len(Ma.Redactions) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Redactions")
+		for _, rule := range Ma.Redactions {
+			St = St + fmt.Sprintf("%s, ", rule)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
 	return St
 }
 
@@ -109,6 +144,6 @@ func (Ma TMessageSmallArea) ToJson() ([]byte, error) {
 
 // ToTxt method converts the TMessageSmallArea structure to a plain text byte array.
 func (Ma TMessageSmallArea) ToTxt() ([]byte, error) {
-	b := []byte(fmt.Sprintf("%+v", Ma))
+	b := []byte(Ma.String())
 	return b, nil
 }
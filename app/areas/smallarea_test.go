@@ -38,7 +38,7 @@ func TestPrepareSmallArea(t *testing.T) {
 	}
 
 	// Call the function
-	result, err := PrepareSmallArea(message)
+	result, err := PrepareSmallArea(message, TAnnotations{})
 
 	// Check no error occurred
 	require.NoError(t, err)
@@ -122,3 +122,18 @@ func TestTMessageSmallArea_ToTxt(t *testing.T) {
 	expected := "ID: 12345\r\nInternal Date: 1620000000000\r\nLabel IDs: INBOX, IMPORTANT, \r\nSize Estimate: 2048\r\nSnippet: This is a snippet\r\nThread ID: 67890\r\n--- Headers ---\r\nMessage-ID: <message123@example.com>\r\nDate: Mon, 3 May 2021 10:00:00 +0000\r\nFrom: sender@example.com\r\nTo: recipient@example.com\r\nSubject: Test Email\r\n--- Plain Text ---\r\nHello, this is a test email!\r\n"
 	assert.Equal(t, expected, string(txtData))
 }
+
+func TestTMessageSmallArea_StringLabelNames(t *testing.T) {
+	message := TMessageSmallArea{
+		Id:         "12345",
+		LabelIds:   []string{"INBOX", "Label_1"},
+		LabelNames: []string{"INBOX", "Work/Clients"},
+	}
+
+	expected := "ID: 12345\r\nInternal Date: 0\r\nLabel IDs: INBOX, Label_1, \r\nLabel Names: INBOX, Work/Clients, \r\nSize Estimate: 0\r\nSnippet: \r\nThread ID: \r\n--- Headers ---\r\nMessage-ID: \r\nDate: \r\nFrom: \r\nTo: \r\nSubject: \r\n--- Plain Text ---\r\n\r\n"
+	assert.Equal(t, expected, message.String())
+
+	jsonData, err := message.ToJson()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"12345","labelIds":["INBOX","Label_1"],"labelNames":["INBOX","Work/Clients"]}`, string(jsonData))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gmailexport/app/getclient"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// tAuthCmd groups the commands that manage the saved authorization
+type tAuthCmd struct {
+	Login  tAuthLoginCmd  `command:"login" description:"Authorize the tool and save the token"`
+	Status tAuthStatusCmd `command:"status" description:"Show the authorized account, scopes and token expiry"`
+	Logout tAuthLogoutCmd `command:"logout" description:"Revoke the saved token and delete it"`
+}
+
+// tAuthLoginCmd asks for consent and saves a new token, replacing the saved one
+type tAuthLoginCmd struct{}
+
+func (cmd *tAuthLoginCmd) Execute(args []string) error {
+	config, err := newConfig(gmail.GmailReadonlyScope)
+	if err != nil {
+		return err
+	}
+	return getclient.Login(config)
+}
+
+// tAuthStatusCmd prints information about the saved token
+type tAuthStatusCmd struct{}
+
+func (cmd *tAuthStatusCmd) Execute(args []string) error {
+	tok, scopes, err := getclient.Token()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	account := "unknown"
+	srv, err := newService(ctx, "", gmail.GmailReadonlyScope)
+	if err != nil {
+		return err
+	}
+	profile, err := srv.Users.GetProfile(user).Context(ctx).Do()
+	if err == nil {
+		account = profile.EmailAddress
+	}
+
+	expiry := "never"
+	if !tok.Expiry.IsZero() {
+		expiry = tok.Expiry.Local().Format(time.RFC1123)
+		if tok.Expiry.Before(time.Now()) {
+			// The access token is refreshed with the refresh token on the next request.
+			expiry = expiry + " (expired)"
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{"unknown"}
+	}
+
+	fmt.Printf("%s: %s\n", "Account", account)
+	fmt.Printf("%s: %s\n", "Scopes", strings.Join(scopes, ", "))
+	fmt.Printf("%s: %s\n", "Expiry", expiry)
+	fmt.Printf("%s: %v\n", "Refresh token", tok.RefreshToken != "")
+	return nil
+}
+
+// tAuthLogoutCmd revokes the saved token and deletes the token file
+type tAuthLogoutCmd struct{}
+
+func (cmd *tAuthLogoutCmd) Execute(args []string) error {
+	if err := getclient.Logout(context.Background()); err != nil {
+		return err
+	}
+	fmt.Printf("Token revoked and %s deleted\n", getclient.TokenFile)
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/areas"
+	"gmailexport/app/redact"
+	"os"
+	"sort"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// fieldsArea is the name of the area defined by --fields
+const fieldsArea = "fields"
+
+// tConfig is the configuration file given with --config
+type tConfig struct {
+	// Areas: custom areas by name, each a comma-separated list of fields in the syntax of --fields.
+	Areas map[string]string `json:"areas"`
+	// Redact: what --redact redacts, instead of the default.
+	Redact *redact.TConfig `json:"redact"`
+}
+
+// loadConfig reads the configuration file
+func loadConfig(path string) (tConfig, error) {
+	var config tConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(b, &config)
+	if err != nil {
+		return config, fmt.Errorf("config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// defineConfigAreas registers the custom areas of the configuration file given in the arguments.
+// It runs before the arguments are parsed, so that --area offers the areas of the file as choices.
+func defineConfigAreas(args []string) error {
+	var preliminary struct {
+		Config string `long:"config"`
+	}
+	parser := flags.NewParser(&preliminary, flags.IgnoreUnknown)
+	_, err := parser.ParseArgs(args)
+	if err != nil || preliminary.Config == "" {
+		// Errors are reported by the full parse
+		return nil
+	}
+	config, err := loadConfig(preliminary.Config)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(config.Areas))
+	for name := range config.Areas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = defineArea(name, config.Areas[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defineFieldsArea registers the area of --fields
+func (statement tStatement) defineFieldsArea() error {
+	if statement.Fields == "" {
+		return nil
+	}
+	return defineArea(fieldsArea, statement.Fields)
+}
+
+// redactConfig returns what --redact redacts: the redact section of the configuration file,
+// or else masking email addresses, phone numbers, IBANs and card numbers
+func (statement tStatement) redactConfig() (*redact.TConfig, error) {
+	if !statement.Redact {
+		return nil, nil
+	}
+	if statement.Config != "" {
+		config, err := loadConfig(statement.Config)
+		if err != nil {
+			return nil, err
+		}
+		if config.Redact != nil {
+			return config.Redact, nil
+		}
+	}
+	config := redact.DefaultConfig
+	return &config, nil
+}
+
+func defineArea(name, spec string) error {
+	fields, err := areas.ParseFields(spec)
+	if err != nil {
+		return fmt.Errorf("area %q: %w", name, err)
+	}
+	return areas.Define(areas.TAreaDefinition{Name: name, Fields: fields})
+}
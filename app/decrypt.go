@@ -0,0 +1,45 @@
+package main
+
+import (
+	"gmailexport/app/encryption"
+	"io"
+	"os"
+)
+
+// tDecryptCmd decrypts a file written with --encrypt-to, to check the export
+type tDecryptCmd struct {
+	Identity []string `short:"i" long:"identity" required:"true" description:"age identity file or OpenPGP private key file; may be repeated. The passphrase of a protected OpenPGP key is read from GMAILEXPORT_PASSPHRASE"`
+	Output   string   `short:"O" long:"output" default:"stdout" description:"output path: stdout - if missing, else output to file"`
+	Args     struct {
+		File string `positional-arg-name:"FILE" description:"encrypted file (default: stdin)"`
+	} `positional-args:"yes"`
+}
+
+func (cmd *tDecryptCmd) Execute(args []string) error {
+	var in io.Reader = os.Stdin
+	if cmd.Args.File != "" {
+		file, err := os.Open(cmd.Args.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	plain, err := encryption.Decrypt(in, cmd.Identity)
+	if err != nil {
+		return err
+	}
+	out := os.Stdout
+	if cmd.Output != "stdout" {
+		out, err = os.OpenFile(cmd.Output, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(out, plain)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tBuffer is a bytes.Buffer that can be closed
+type tBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *tBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// encrypt returns the text encrypted for the recipients
+func encrypt(t *testing.T, recipients []string, text string) *tBuffer {
+	e, err := NewEncryptor(recipients)
+	require.NoError(t, err)
+	var out tBuffer
+	w, err := e.Encrypt(&out)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, text)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.True(t, out.closed)
+	return &out
+}
+
+// decrypt returns the plain text of the encrypted stream
+func decrypt(t *testing.T, in io.Reader, identities []string) string {
+	plain, err := Decrypt(in, identities)
+	require.NoError(t, err)
+	b, err := io.ReadAll(plain)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestAge(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	require.NoError(t, os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600))
+
+	e, err := NewEncryptor([]string{identity.Recipient().String()})
+	require.NoError(t, err)
+	assert.Equal(t, ".age", e.Extension())
+
+	out := encrypt(t, []string{identity.Recipient().String()}, "secret mail")
+	assert.NotContains(t, out.String(), "secret mail")
+	assert.Equal(t, "secret mail", decrypt(t, out, []string{identityFile}))
+}
+
+func TestOpenPgp(t *testing.T) {
+	dir := t.TempDir()
+	entity, err := openpgp.NewEntity("Auditor", "", "auditor@example.com", nil)
+	require.NoError(t, err)
+	var public, private bytes.Buffer
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	w, err = armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+	publicFile := filepath.Join(dir, "public.asc")
+	privateFile := filepath.Join(dir, "private.asc")
+	require.NoError(t, os.WriteFile(publicFile, public.Bytes(), 0600))
+	require.NoError(t, os.WriteFile(privateFile, private.Bytes(), 0600))
+
+	e, err := NewEncryptor([]string{publicFile})
+	require.NoError(t, err)
+	assert.Equal(t, ".gpg", e.Extension())
+
+	out := encrypt(t, []string{publicFile}, "secret mail")
+	assert.Equal(t, "secret mail", decrypt(t, out, []string{privateFile}))
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	_, err = NewEncryptor([]string{publicFile, identity.Recipient().String()})
+	assert.EqualError(t, err, "the recipients mix age and OpenPGP keys")
+}
+
+func TestNewEncryptorErrors(t *testing.T) {
+	_, err := NewEncryptor(nil)
+	assert.EqualError(t, err, "no recipients")
+	_, err = NewEncryptor([]string{"age1invalid"})
+	assert.Error(t, err)
+	_, err = NewEncryptor([]string{filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
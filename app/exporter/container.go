@@ -0,0 +1,299 @@
+package exporter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/encryption"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions are the values of TStatement.Compress: "gzip" and "zstd" compress each output file,
+// "zip", "tar.gz" and "tar.zst" write the files of a split export as the entries of an archive.
+var Compressions = []string{"gzip", "zstd", "zip", "tar.gz", "tar.zst"}
+
+// compressionExtensions are the extensions of the compressions, the longest first
+var compressionExtensions = []struct{ extension, compress string }{
+	{".tar.gz", "tar.gz"},
+	{".tar.zst", "tar.zst"},
+	{".zip", "zip"},
+	{".gz", "gzip"},
+	{".zst", "zstd"},
+}
+
+// ManifestEntry is the name of the last entry of an archive, the TArchiveManifest of its entries
+const ManifestEntry = "manifest.json"
+
+// isArchive reports whether the compression writes the output files into an archive
+func isArchive(compress string) bool {
+	return compress == "zip" || compress == "tar.gz" || compress == "tar.zst"
+}
+
+// compressionExtension returns the extension of the files written with the compression
+func compressionExtension(compress string) string {
+	for _, c := range compressionExtensions {
+		if c.compress == compress {
+			return c.extension
+		}
+	}
+	return ""
+}
+
+// resolveCompression returns the statement with the compression chosen by Compress or by the extension
+// of the output, which is taken off the output. An archive implies a split export.
+func resolveCompression(statement TStatement) (TStatement, error) {
+	if statement.Compress != "" && !slices.Contains(Compressions, statement.Compress) {
+		return statement, fmt.Errorf("unknown compression %q", statement.Compress)
+	}
+	if statement.Output != "stdout" {
+		for _, c := range compressionExtensions {
+			name, ok := strings.CutSuffix(statement.Output, c.extension)
+			if !ok {
+				continue
+			}
+			if statement.Compress != "" && statement.Compress != c.compress {
+				return statement, fmt.Errorf("the output %s does not match the %s compression", statement.Output, statement.Compress)
+			}
+			statement.Output = name
+			statement.Compress = c.compress
+			break
+		}
+	}
+	if isArchive(statement.Compress) {
+		if statement.Append {
+			return statement, fmt.Errorf("an archive cannot be appended to")
+		}
+		statement.Split = true
+	}
+	return statement, nil
+}
+
+// tCodec compresses with gzip or zstd, then encrypts, what is written to an output file
+type tCodec struct {
+	compress  string
+	encryptor *encryption.TEncryptor
+}
+
+// newCodec returns the codec of the statement. The compression of an archive applies to the
+// archive, not to its entries, so its codec only encrypts.
+func newCodec(statement TStatement) (*tCodec, error) {
+	c := &tCodec{}
+	if statement.Compress == "gzip" || statement.Compress == "zstd" {
+		c.compress = statement.Compress
+	}
+	if len(statement.EncryptTo) > 0 {
+		encryptor, err := encryption.NewEncryptor(statement.EncryptTo)
+		if err != nil {
+			return nil, err
+		}
+		c.encryptor = encryptor
+	}
+	return c, nil
+}
+
+// extension returns the extensions added to the output files, such as ".gz.age"
+func (c *tCodec) extension() string {
+	extension := compressionExtension(c.compress)
+	if c.encryptor != nil {
+		extension += c.encryptor.Extension()
+	}
+	return extension
+}
+
+// wrap returns a writer that compresses and encrypts into the file. Closing it closes the file.
+func (c *tCodec) wrap(file io.WriteCloser) (io.WriteCloser, error) {
+	var err error
+	if c.encryptor != nil {
+		file, err = c.encryptor.Encrypt(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return compressor(c.compress, file)
+}
+
+// compressor returns a writer that compresses into the file with gzip or zstd, the file itself
+// without compression. Closing it closes the file.
+func compressor(compress string, file io.WriteCloser) (io.WriteCloser, error) {
+	switch compress {
+	case "gzip", "tar.gz":
+		return &tChainedWriter{WriteCloser: gzip.NewWriter(file), file: file}, nil
+	case "zstd", "tar.zst":
+		encoder, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &tChainedWriter{WriteCloser: encoder, file: file}, nil
+	default:
+		return file, nil
+	}
+}
+
+// tChainedWriter closes the file after the writer into it
+type tChainedWriter struct {
+	io.WriteCloser
+	file io.WriteCloser
+}
+
+func (w *tChainedWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// TArchiveManifest is the last entry of an archive
+type TArchiveManifest struct {
+	// Created: when the archive was created.
+	Created time.Time `json:"created"`
+	// Entries: the other entries of the archive, in order.
+	Entries []TArchiveEntry `json:"entries"`
+}
+
+// TArchiveEntry is an entry of an archive with the SHA-256 of its content, in hex
+type TArchiveEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// tArchive writes the output files as the entries of a zip, tar.gz or tar.zst archive, followed by
+// the manifest. The archive is created with the first entry, so nothing is created when nothing is found.
+type tArchive struct {
+	path     string
+	compress string
+	codec    *tCodec
+	file     io.WriteCloser
+	zip      *zip.Writer
+	tar      *tar.Writer
+	manifest TArchiveManifest
+}
+
+// newArchive returns the archive of the statement, the output with the extension of the compression
+func newArchive(statement TStatement) (*tArchive, error) {
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	path := statement.Output
+	if path != "stdout" {
+		path += compressionExtension(statement.Compress)
+	}
+	return &tArchive{path: path, compress: statement.Compress, codec: codec, manifest: TArchiveManifest{Created: time.Now().UTC()}}, nil
+}
+
+// add writes an entry to the archive
+func (a *tArchive) add(name string, data []byte) error {
+	if a.file == nil {
+		file, err := openOutput(a.path, false, a.codec)
+		if err != nil {
+			return err
+		}
+		if a.compress == "zip" {
+			a.file = file
+			a.zip = zip.NewWriter(file)
+		} else {
+			a.file, err = compressor(a.compress, file)
+			if err != nil {
+				return err
+			}
+			a.tar = tar.NewWriter(a.file)
+		}
+	}
+	modified := time.Now()
+	if a.zip != nil {
+		w, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := a.tar.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modified, Typeflag: tar.TypeReg})
+		if err != nil {
+			return err
+		}
+		_, err = a.tar.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+	if name != ManifestEntry {
+		sum := sha256.Sum256(data)
+		a.manifest.Entries = append(a.manifest.Entries, TArchiveEntry{Name: name, Size: int64(len(data)), Sha256: hex.EncodeToString(sum[:])})
+	}
+	return nil
+}
+
+// close writes the manifest and closes the archive
+func (a *tArchive) close() error {
+	if a.file == nil {
+		return nil
+	}
+	manifest, err := json.MarshalIndent(a.manifest, "", "  ")
+	if err == nil {
+		err = a.add(ManifestEntry, manifest)
+	}
+	if err == nil && a.zip != nil {
+		err = a.zip.Close()
+	}
+	if err == nil && a.tar != nil {
+		err = a.tar.Close()
+	}
+	if err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// newSplitOutput returns the output of a file per message, or of an entry per message when the
+// statement writes an archive. Entries without an extension get the extension of the format.
+func newSplitOutput(statement TStatement, extension, header, footer string) (*tSplitOutput, error) {
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	out := &tSplitOutput{path: statement.Output, codec: codec, header: header, footer: footer, skipExisting: statement.Dedup != ""}
+	if isArchive(statement.Compress) {
+		out.archive, err = newArchive(statement)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(statement.Output)
+		if statement.Output == "stdout" {
+			name = "message"
+		}
+		if filepath.Ext(name) == "" {
+			name += extension
+		}
+		out.path = name
+	}
+	return out, nil
+}
+
+// entry returns the header, the block and the footer of a file or an archive entry
+func (out *tSplitOutput) entry(block []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(out.header)
+	buf.Write(block)
+	buf.WriteString(out.footer)
+	return buf.Bytes()
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the messages are written as the entries of a zip archive, followed by the manifest
+func TestExportZip(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.zip"), Format: "json", Area: "small"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	archive, err := zip.OpenReader(filepath.Join(dir, "gmail.zip"))
+	require.NoError(t, err)
+	defer archive.Close()
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"gmail_0.json", "gmail_1.json", ManifestEntry}, names)
+
+	var message map[string]interface{}
+	readZipEntry(t, archive.File[0], &message)
+	assert.Equal(t, "Message 2", message["subject"])
+	var manifest TArchiveManifest
+	readZipEntry(t, archive.File[2], &manifest)
+	require.Len(t, manifest.Entries, 2)
+	assert.Equal(t, "gmail_1.json", manifest.Entries[1].Name)
+	assert.Equal(t, int64(archive.File[1].UncompressedSize64), manifest.Entries[1].Size)
+	assert.False(t, manifest.Created.IsZero())
+}
+
+func readZipEntry(t *testing.T, f *zip.File, v any) {
+	r, err := f.Open()
+	require.NoError(t, err)
+	defer r.Close()
+	require.NoError(t, json.NewDecoder(r).Decode(v))
+}
+
+// Test --compress writes a tar.zst archive, whose entries get the extension of the format
+func TestExportTarZst(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail"), Compress: "tar.zst", Format: "markdown", Area: "all"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	file, err := os.Open(filepath.Join(dir, "gmail.tar.zst"))
+	require.NoError(t, err)
+	defer file.Close()
+	decoder, err := zstd.NewReader(file)
+	require.NoError(t, err)
+	defer decoder.Close()
+	archive := tar.NewReader(decoder)
+	var names []string
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		b, err := io.ReadAll(archive)
+		require.NoError(t, err)
+		if header.Name == "gmail_0.md" {
+			assert.Contains(t, string(b), "Message 2")
+		}
+	}
+	assert.Equal(t, []string{"gmail_0.md", "gmail_1.md", ManifestEntry}, names)
+}
+
+// Test a single output ending with .gz is compressed, and appending adds a gzip member
+func TestExportGzip(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.ndjson.gz"), Format: "ndjson", Area: "small", Append: true}
+
+	for i := 0; i < 2; i++ {
+		_, err := NewWithClient(newTestMailbox(t, 1), "me", TFilter{}, statement).Export(context.Background())
+		require.NoError(t, err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "gmail.ndjson.gz"))
+	require.NoError(t, err)
+	defer file.Close()
+	r, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	decoder := json.NewDecoder(r)
+	count := 0
+	for decoder.More() {
+		var message map[string]interface{}
+		require.NoError(t, decoder.Decode(&message))
+		assert.Equal(t, "Message 1", message["subject"])
+		count++
+	}
+	assert.Equal(t, 2, count)
+
+	// The message of the second export follows the content it was appended to
+	manifest := readManifest(t, filepath.Join(dir, "gmail_1"+ManifestSuffix))
+	require.Len(t, manifest.Messages, 1)
+	assert.Equal(t, manifest.Messages[0].Bytes, manifest.Messages[0].Offset)
+	problems, err := Verify(filepath.Join(dir, "gmail_1"+ManifestSuffix))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestResolveCompression(t *testing.T) {
+	statement, err := resolveCompression(TStatement{Output: "out/gmail.tar.gz"})
+	require.NoError(t, err)
+	assert.Equal(t, TStatement{Output: "out/gmail", Compress: "tar.gz", Split: true}, statement)
+
+	statement, err = resolveCompression(TStatement{Output: "stdout", Compress: "zstd"})
+	require.NoError(t, err)
+	assert.Equal(t, TStatement{Output: "stdout", Compress: "zstd"}, statement)
+
+	_, err = resolveCompression(TStatement{Output: "gmail.zip", Compress: "gzip"})
+	assert.EqualError(t, err, "the output gmail.zip does not match the gzip compression")
+	_, err = resolveCompression(TStatement{Output: "gmail.zip", Format: "ndjson", Append: true})
+	assert.EqualError(t, err, "an archive cannot be appended to")
+	_, err = newOutput(TStatement{Output: "gmail.zip", Format: "parquet"})
+	assert.EqualError(t, err, "the parquet format cannot be written into an archive")
+}
@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"gmailexport/app/areas"
+	"gmailexport/app/threading"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// conversations rebuilds the conversation trees of the messages from their headers.
+// It returns the messages in the order of the trees, each conversation after the previous one
+// and each reply after the message it replies to, and the places of the messages by Gmail ID.
+func conversations(messages []*gmail.Message) ([]*gmail.Message, map[string]*areas.TConversation) {
+	byId := make(map[string]*gmail.Message, len(messages))
+	input := make([]threading.TMessage, len(messages))
+	for i, m := range messages {
+		byId[m.Id] = m
+		input[i] = threading.TMessage{
+			Id:         m.Id,
+			MessageId:  messageHeader(m, "Message-ID"),
+			InReplyTo:  messageHeader(m, "In-Reply-To"),
+			References: messageHeader(m, "References"),
+			Subject:    messageHeader(m, "Subject"),
+			From:       messageHeader(m, "From"),
+			Date:       m.InternalDate,
+		}
+	}
+
+	ordered := make([]*gmail.Message, 0, len(messages))
+	places := make(map[string]*areas.TConversation, len(messages))
+	roots := threading.Thread(input)
+	threading.Walk(roots, func(n *threading.TNode) {
+		if n.Message == nil {
+			return
+		}
+		place := &areas.TConversation{Depth: n.Depth()}
+		if n.Parent != nil {
+			place.ParentMessageId = n.Parent.MessageId
+			if n.Parent.Message != nil {
+				place.ParentId = n.Parent.Message.Id
+				place.ParentMessageId = n.Parent.Message.MessageId
+			}
+		}
+		root := n.Root()
+		place.RootMessageId = root.MessageId
+		if root.Message != nil {
+			// Messages without a Message-ID header have none
+			place.RootMessageId = root.Message.MessageId
+		}
+		place.Tree = threading.Render(root, n)
+		places[n.Message.Id] = place
+		ordered = append(ordered, byId[n.Message.Id])
+	})
+	return ordered, places
+}
+
+// messageHeader returns the value of the first header of the message with the name
+func messageHeader(m *gmail.Message, name string) string {
+	if m.Payload == nil {
+		return ""
+	}
+	for _, h := range m.Payload.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportConversations(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small", Conversations: true}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 3, Exported: 3}, summary)
+
+	messages := readJson(t, path)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "Plan", messages[0]["subject"])
+	assert.Equal(t, map[string]interface{}{"rootMessageId": "<plan@example.com>", "depth": float64(0)}, messages[0]["conversation"])
+	assert.Equal(t, "Re: Plan", messages[1]["subject"])
+	assert.Equal(t, map[string]interface{}{
+		"parentId":        messages[0]["id"],
+		"parentMessageId": "<plan@example.com>",
+		"rootMessageId":   "<plan@example.com>",
+		"depth":           float64(1),
+	}, messages[1]["conversation"])
+	assert.Equal(t, "Other", messages[2]["subject"])
+}
+
+func TestExportConversationsTxt(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "txt", Area: "easy", ByThread: true, Conversations: true}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "--- Conversation ---\r\n")
+	assert.Contains(t, string(b), "> └─ Re: Plan (Bob <bob@example.com>)\r\n")
+}
+
+// Test the messages are exported without conversation unless requested
+func TestExportWithoutConversations(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small"}).Export(context.Background())
+	require.NoError(t, err)
+
+	for _, message := range readJson(t, path) {
+		assert.NotContains(t, message, "conversation")
+	}
+}
@@ -0,0 +1,159 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// IndexFileName is the name of the dedup index created next to the output when no index is given
+const IndexFileName = ".gmailexport-index"
+
+// tDedupIndex remembers the exported messages so that they are not exported again.
+// Messages are known by their Gmail ID and, in "content" mode, also by their Message-ID header
+// and the hash of their body, which find the same message in another mailbox or imported twice.
+// The index file has a key per line, "id <Gmail ID>" or "content <Message-ID> <SHA-256 of the body>",
+// and is appended to as messages are exported, so an interrupted export is remembered too.
+type tDedupIndex struct {
+	mode string
+	keys map[string]bool
+	file *os.File
+}
+
+// openDedupIndex loads the index defined by the statement. Without Dedup it remembers nothing.
+// The index is kept in memory only when the output is stdout and no index file is given.
+func openDedupIndex(statement TStatement) (*tDedupIndex, error) {
+	index := &tDedupIndex{mode: statement.Dedup, keys: make(map[string]bool)}
+	switch statement.Dedup {
+	case "":
+		return index, nil
+	case "id", "content":
+	default:
+		return nil, fmt.Errorf("unknown dedup mode %q", statement.Dedup)
+	}
+	path := indexPath(statement)
+	if path == "" {
+		return index, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			index.keys[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read dedup index %s: %w", path, err)
+	}
+	index.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// indexPath returns the path of the index file of the statement, "" when there is none
+func indexPath(statement TStatement) string {
+	if statement.Index != "" {
+		return statement.Index
+	}
+	if statement.Output == "stdout" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(statement.Output), IndexFileName)
+}
+
+// hasId reports whether the message with the Gmail ID was exported
+func (index *tDedupIndex) hasId(id string) bool {
+	return index.keys["id "+id]
+}
+
+// hasMessage reports whether the message was exported, by ID or, in "content" mode, by content
+func (index *tDedupIndex) hasMessage(message *gmail.Message) bool {
+	if index.hasId(message.Id) {
+		return true
+	}
+	key := index.contentKey(message)
+	return key != "" && index.keys[key]
+}
+
+// hasThread reports whether all messages of the thread were exported
+func (index *tDedupIndex) hasThread(thread *gmail.Thread) bool {
+	if len(thread.Messages) == 0 {
+		return false
+	}
+	for _, message := range thread.Messages {
+		if !index.hasMessage(message) {
+			return false
+		}
+	}
+	return true
+}
+
+// add remembers the exported message
+func (index *tDedupIndex) add(message *gmail.Message) error {
+	if index.mode == "" {
+		return nil
+	}
+	keys := []string{"id " + message.Id}
+	if key := index.contentKey(message); key != "" {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if index.keys[key] {
+			continue
+		}
+		index.keys[key] = true
+		if index.file != nil {
+			_, err := fmt.Fprintln(index.file, key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contentKey returns the content key of the message, "" outside "content" mode or when the
+// message has no Message-ID header or raw content
+func (index *tDedupIndex) contentKey(message *gmail.Message) string {
+	if index.mode != "content" {
+		return ""
+	}
+	messageId := strings.Join(strings.Fields(messageHeader(message, "Message-ID")), "")
+	if messageId == "" || message.Raw == "" {
+		return ""
+	}
+	raw, err := base64.URLEncoding.DecodeString(message.Raw)
+	if err != nil {
+		return ""
+	}
+	// The headers differ between mailboxes (Received, Delivered-To), so only the body is hashed
+	body := raw
+	for _, separator := range []string{"\r\n\r\n", "\n\n"} {
+		if i := bytes.Index(raw, []byte(separator)); i >= 0 {
+			body = raw[i+len(separator):]
+			break
+		}
+	}
+	sum := sha256.Sum256(body)
+	return "content " + messageId + " " + hex.EncodeToString(sum[:])
+}
+
+func (index *tDedupIndex) close() error {
+	if index.file == nil {
+		return nil
+	}
+	return index.file.Close()
+}
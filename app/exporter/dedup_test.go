@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"gmailexport/app/gmailapi/fake"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Test repeated exports with different filters into one directory write each message once
+func TestExportDedupId(t *testing.T) {
+	mailbox := newTestMailbox(t, 3)
+	id := mailbox.AddLabel(&gmail.Label{Name: "Work"})
+	mailbox.ModifyLabels("2", []string{id}, nil)
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "message.json"), Split: true, Format: "json", Area: "small", Dedup: "id"}
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{Label: "Work"}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 1, Exported: 1}, summary)
+
+	summary, err = NewWithClient(mailbox, "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 3, Exported: 2, Duplicates: 1}, summary)
+	// The duplicate is not fetched again: full and raw for 1 + 2 messages
+	assert.Equal(t, 6, mailbox.Calls("GetMessage"))
+
+	summary, err = NewWithClient(mailbox, "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 3, Exported: 0, Duplicates: 3}, summary)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	// The three messages, the index and the manifest of each export
+	assert.Len(t, entries, 7)
+	assert.FileExists(t, filepath.Join(dir, "message_2"+ManifestSuffix))
+	b, err := os.ReadFile(filepath.Join(dir, IndexFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "id 2\nid 3\nid 1\n", string(b))
+}
+
+// Test the same message in another mailbox is found by Message-ID and body hash
+func TestExportDedupContent(t *testing.T) {
+	index := filepath.Join(t.TempDir(), "index")
+	statement := TStatement{Output: "stdout", Format: "json", Area: "small", Dedup: "content", Index: index}
+
+	summary, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Exported)
+
+	other := fake.New()
+	for i, raw := range []string{
+		// The same message 1 with other delivery headers
+		"Delivered-To: other@example.com\r\nFrom: sender1@example.com\r\nTo: me@example.com\r\nSubject: Message 1\r\n" +
+			"Date: Mon, 1 May 2021 10:00:00 +0000\r\nMessage-ID: <1@example.com>\r\n\r\nBody 1\r\n",
+		// The same Message-ID with another body
+		"From: sender2@example.com\r\nSubject: Message 2\r\nMessage-ID: <2@example.com>\r\n\r\nChanged\r\n",
+	} {
+		message, err := fake.ParseMessage([]byte(raw))
+		require.NoError(t, err)
+		message.Id = fmt.Sprint("other", i)
+		other.AddMessage(message)
+	}
+	summary, err = NewWithClient(other, "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 2, Exported: 1, Duplicates: 1}, summary)
+}
+
+func TestExportDedupThreads(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "thread.json"), Split: true, Format: "json", Area: "small", ByThread: true, Dedup: "id"}
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{Subject: "Other"}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 1, Exported: 1}, summary)
+
+	summary, err = NewWithClient(mailbox, "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 2, Exported: 1, Duplicates: 1}, summary)
+}
+
+func TestOpenDedupIndexUnknownMode(t *testing.T) {
+	_, err := openDedupIndex(TStatement{Output: "stdout", Dedup: "hash"})
+	assert.EqualError(t, err, `unknown dedup mode "hash"`)
+}
@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// The phases of an export, recorded in TError and in the log
+const (
+	// PhaseList: listing the IDs of the messages or threads.
+	PhaseList = "list"
+	// PhaseFetch: getting a message or a thread from Gmail.
+	PhaseFetch = "fetch"
+	// PhaseFormat: preparing a message according to the area, redacting and formatting it.
+	PhaseFormat = "format"
+	// PhaseWrite: writing the formatted message to the output, or calling the callback of Each.
+	PhaseWrite = "write"
+	// PhaseIndex: adding the message to the dedup index.
+	PhaseIndex = "index"
+)
+
+// TError is an error of an export in a phase, with the message or thread it concerns, if any
+type TError struct {
+	Phase     string
+	MessageId string
+	ThreadId  string
+	Err       error
+}
+
+func (e *TError) Error() string {
+	switch {
+	case e.MessageId != "":
+		return fmt.Sprintf("%s message %s: %v", e.Phase, e.MessageId, e.Err)
+	case e.ThreadId != "":
+		return fmt.Sprintf("%s thread %s: %v", e.Phase, e.ThreadId, e.Err)
+	default:
+		return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+	}
+}
+
+func (e *TError) Unwrap() error {
+	return e.Err
+}
+
+// LogValue logs the phase, the IDs and the cause as attributes
+func (e *TError) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("phase", e.Phase)}
+	if e.MessageId != "" {
+		attrs = append(attrs, slog.String("id", e.MessageId))
+	}
+	if e.ThreadId != "" {
+		attrs = append(attrs, slog.String("threadId", e.ThreadId))
+	}
+	attrs = append(attrs, slog.String("cause", e.Err.Error()))
+	return slog.GroupValue(attrs...)
+}
+
+// messageError returns the error of a phase of the message, nil without error
+func messageError(phase, messageId, threadId string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TError{Phase: phase, MessageId: messageId, ThreadId: threadId, Err: err}
+}
@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorString(t *testing.T) {
+	cause := errors.New("boom")
+	assert.Equal(t, "fetch message 1: boom", (&TError{Phase: PhaseFetch, MessageId: "1", ThreadId: "t", Err: cause}).Error())
+	assert.Equal(t, "write thread t: boom", (&TError{Phase: PhaseWrite, ThreadId: "t", Err: cause}).Error())
+	assert.Equal(t, "list: boom", (&TError{Phase: PhaseList, Err: cause}).Error())
+	assert.NoError(t, messageError(PhaseIndex, "1", "t", nil))
+}
+
+// Test the debug log has a line per message with its ID and phase
+func TestExportLogged(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, TStatement{Output: filepath.Join(t.TempDir(), "out.json"), Format: "json", Area: "raw"})
+	e.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	_, err := e.Export(context.Background())
+	require.NoError(t, err)
+
+	exported := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		if record["msg"] == "message exported" {
+			exported[record["id"].(string)] = record["phase"].(string)
+		}
+	}
+	assert.Equal(t, map[string]string{"1": PhaseWrite, "2": PhaseWrite}, exported)
+}
@@ -0,0 +1,498 @@
+// Package exporter searches Gmail messages, prepares them according to an area
+// and writes them in the requested format. The gmailexport command is a thin
+// wrapper around it, and other Go programs can embed it the same way.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"gmailexport/app/areas"
+	"gmailexport/app/gmailapi"
+	"gmailexport/app/redact"
+	"log/slog"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// ErrNothingFound is returned by Export when the filter selects no messages
+var ErrNothingFound = errors.New("nothing found")
+
+// TStatement represents the output options for the exported messages
+type TStatement struct {
+	// Output: "stdout", or the path of the output file (the name template when Split is set).
+	Output string
+	// Split: write each message to a separate file.
+	Split bool
+	// Format: "json", "ndjson" for a JSON object per line, "txt", "csv", "tsv" and "parquet" for a row
+	// per message, "sqlite" to upsert the messages into an archive database, or "markdown", "html" and
+	// "pdf" for a readable document.
+	Format string
+	// Append: append to the output file if it exists, only with the ndjson format and a single output.
+	Append bool
+	// Area: fullness of the output, "raw", "all", "small" or "easy". The formats that write rows or
+	// records (csv, tsv, parquet, sqlite, markdown, html and pdf) only take "all", unless there is a Template.
+	Area string
+	// ByThread: export threads instead of messages, each with its messages.
+	ByThread bool
+	// Conversations: rebuild the conversation trees from the message headers, add the place
+	// in the tree to each message and export the messages in the order of the trees.
+	// All messages (of a thread, when exporting by thread) are fetched before they are exported.
+	Conversations bool
+	// Dedup: skip the messages exported before, "" (off), "id" to know them by Gmail ID, or "content"
+	// to know them also by Message-ID header and body hash. When exporting by thread, a thread is
+	// skipped when all its messages were exported before.
+	Dedup string
+	// Index: the path of the dedup index file; by default IndexFileName in the directory of the output.
+	Index string
+	// Columns: the columns of the csv and tsv formats, some of TableColumns; all of them by default.
+	Columns []string
+	// Separator: joins the values of multi-valued columns, DefaultSeparator by default.
+	Separator string
+	// BOM: start csv and tsv files with a byte order mark, for Excel.
+	BOM bool
+	// RowGroupSize: the number of messages of a parquet row group, DefaultRowGroupSize by default.
+	RowGroupSize int
+	// Compression: the codec of the parquet format, one of ParquetCompressions; "snappy" by default.
+	Compression string
+	// Template: the path of a text/template file that renders each prepared message (each thread when
+	// exporting by thread) instead of the format. The templates "header" and "footer", if the file defines
+	// them, are rendered with the statement at the start and the end of every output file.
+	Template string
+	// PdfFont: the path of a TrueType font for the pdf format, needed for characters outside Windows-1252.
+	PdfFont string
+	// EncryptTo: the recipients every output file is encrypted for, age public keys ("age1…"), SSH public keys,
+	// or files of age recipients or OpenPGP public keys. The files get the extension ".age" or ".gpg".
+	EncryptTo []string
+	// Compress: "gzip" or "zstd" to compress every output file, or "zip", "tar.gz" or "tar.zst" to write
+	// the files of a split export into an archive with a manifest entry. An output with the extension
+	// of a compression (".gz", ".zst", ".zip", ".tar.gz", ".tar.zst") selects it too.
+	Compress string
+	// Redact: what is redacted from the prepared messages, which record the rules that fired, and from
+	// the participants of the threads; nil exports the messages as they are. The formats that write rows
+	// or records are made from the Gmail messages redacted the same way, without the rules that fired.
+	Redact *redact.TConfig
+	// Manifest: the path of the TManifest written after the export; by default the output without its
+	// extension followed by ManifestSuffix. None is written for stdout unless Manifest is set.
+	// An existing manifest is an error, see createManifest.
+	Manifest string
+	// OnError: what happens when a message cannot be fetched or formatted, one of OnErrors;
+	// "fail" by default.
+	OnError string
+	// ErrorsFile: the path of the TFailure lines of the messages skipped with the OnError policy "skip"
+	// or "retry"; by default the output without its extension followed by ErrorsSuffix. None is written
+	// for stdout unless ErrorsFile is set.
+	ErrorsFile string
+}
+
+// TResult is an exported message: the message as returned by Gmail,
+// the message prepared according to the area and its formatted output.
+// When exporting by thread it is an exported thread: Thread is the thread as returned by Gmail,
+// Area is the *TThread with the prepared messages, and Message is nil.
+// Block is the output of the format; it is nil for the formats that write their own files (parquet,
+// sqlite, markdown, html and pdf), whose outputs take the records of the messages instead.
+type TResult struct {
+	Message *gmail.Message
+	Thread  *gmail.Thread
+	Area    any
+	Block   []byte
+
+	// records: the records of the messages for the formats that write their own files, such as []TParquetMessage.
+	records any
+}
+
+// Exporter exports the messages of a Gmail user that match a filter
+type Exporter struct {
+	client    gmailapi.IClient
+	user      string
+	filter    TFilter
+	statement TStatement
+	template  *tTemplate
+	redactor  *redact.TRedactor
+	// resultSizeEstimate: Gmail's estimate of the messages found, set by the search.
+	resultSizeEstimate int64
+	progress           *tProgress
+	logger             *slog.Logger
+}
+
+// New returns an Exporter of the messages of the user (an email address or "me")
+// that match the filter, presented according to the statement.
+func New(srv *gmail.Service, user string, filter TFilter, statement TStatement) *Exporter {
+	return NewWithClient(gmailapi.New(srv), user, filter, statement)
+}
+
+// NewWithClient returns an Exporter that makes the Gmail API calls with the client,
+// for example the in-memory mailbox of package gmailapi/fake.
+func NewWithClient(client gmailapi.IClient, user string, filter TFilter, statement TStatement) *Exporter {
+	return &Exporter{
+		client:    client,
+		user:      user,
+		filter:    filter,
+		statement: statement,
+		logger:    slog.Default(),
+	}
+}
+
+// SetLogger makes the export log to the logger instead of the default logger of package slog.
+// Every message is logged at the debug level with its Gmail ID and the phase.
+func (e *Exporter) SetLogger(logger *slog.Logger) {
+	e.logger = logger
+}
+
+// TSummary counts the messages handled by an export, or the threads when exporting by thread
+type TSummary struct {
+	// Found: the number of messages selected by the filter (found so far, if the search was interrupted).
+	Found int
+	// Exported: the number of messages passed to the callback or written to the output.
+	Exported int
+	// Duplicates: the number of messages skipped because they were exported before.
+	Duplicates int
+	// Failed: the messages skipped on error with the OnError policy "skip" or "retry".
+	Failed []TFailure
+}
+
+// Remaining returns the number of found messages that were neither exported nor skipped
+// as duplicates or on error
+func (summary TSummary) Remaining() int {
+	return summary.Found - summary.Exported - summary.Duplicates - len(summary.Failed)
+}
+
+// Each searches the messages and calls fn for each of them in the order returned by Gmail,
+// except for the duplicates when the statement asks for Dedup.
+// It stops at the first error, including the one returned by fn, and when ctx is done;
+// the OnError policy of the statement may skip the messages that cannot be fetched or formatted.
+// With the parquet, sqlite, markdown, html and pdf formats the results have no Block, see TResult.
+func (e *Exporter) Each(ctx context.Context, fn func(TResult) error) error {
+	var summary TSummary
+	return e.each(ctx, &summary, fn)
+}
+
+// each is Each counting the messages in summary
+func (e *Exporter) each(ctx context.Context, summary *TSummary, fn func(TResult) error) error {
+	err := checkArea(e.statement)
+	if err != nil {
+		return err
+	}
+	if e.statement.Template != "" && e.template == nil {
+		template, err := loadTemplate(e.statement.Template)
+		if err != nil {
+			return err
+		}
+		e.template = template
+	}
+	if e.statement.Redact != nil && e.redactor == nil {
+		redactor, err := newRedactor(e.statement)
+		if err != nil {
+			return err
+		}
+		e.redactor = redactor
+	}
+	index, err := openDedupIndex(e.statement)
+	if err != nil {
+		return err
+	}
+	err = e.eachIndexed(ctx, index, summary, fn)
+	if err != nil {
+		index.close()
+		return err
+	}
+	return index.close()
+}
+
+// eachIndexed is each skipping the messages of the dedup index
+func (e *Exporter) eachIndexed(ctx context.Context, index *tDedupIndex, summary *TSummary, fn func(TResult) error) error {
+	catalog, err := loadLabelCatalog(ctx, e.client, e.user)
+	if err != nil {
+		return err
+	}
+	filter := e.filter
+	filter.Label = catalog.queryName(filter.Label)
+	if e.statement.ByThread {
+		return e.eachThread(ctx, catalog, index, filter, summary, fn)
+	}
+	e.progress.start("messages")
+	listMessages, err := search(ctx, e.client, e.user, filter, e.progress)
+	if listMessages != nil {
+		summary.Found = len(listMessages.messages)
+		e.resultSizeEstimate = listMessages.resultSizeEstimate
+	}
+	if err != nil {
+		return messageError(PhaseList, "", "", err)
+	}
+	e.progress.found(summary.Found)
+	e.logger.Debug("messages listed", "phase", PhaseList, "query", filter.Query(), "found", summary.Found, "resultSizeEstimate", e.resultSizeEstimate)
+	if e.statement.Conversations {
+		return e.eachConversation(ctx, catalog, index, listMessages, summary, fn)
+	}
+	for _, m := range listMessages.messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if index.hasId(m.Id) {
+			summary.Duplicates++
+			e.progress.duplicate()
+			e.logger.Debug("duplicate skipped", "id", m.Id)
+			continue
+		}
+		message, attempts, err := e.fetch(ctx, m)
+		if err != nil {
+			err = e.failed(ctx, summary, messageError(PhaseFetch, m.Id, m.ThreadId, err), attempts)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = e.eachMessage(ctx, message, catalog.annotations(message), index, summary, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch gets the message, again after a failure with the OnError policy "retry", and returns
+// the number of attempts
+func (e *Exporter) fetch(ctx context.Context, m *gmail.Message) (*gmail.Message, int, error) {
+	var message *gmail.Message
+	attempts, err := e.retry(ctx, m.Id, func() (err error) {
+		message, err = fetch(ctx, e.client, e.user, m.Id)
+		return err
+	})
+	if err != nil {
+		return nil, attempts, err
+	}
+	e.progress.fetched()
+	e.logger.Debug("message fetched", "id", m.Id, "threadId", m.ThreadId, "phase", PhaseFetch)
+	return message, attempts, nil
+}
+
+// eachMessage prepares the message and calls fn with it, unless it is in the dedup index
+func (e *Exporter) eachMessage(ctx context.Context, message *gmail.Message, annotations areas.TAnnotations, index *tDedupIndex, summary *TSummary, fn func(TResult) error) error {
+	logger := e.logger.With("id", message.Id, "threadId", message.ThreadId)
+	if index.hasMessage(message) {
+		summary.Duplicates++
+		e.progress.duplicate()
+		logger.Debug("duplicate skipped")
+		return nil
+	}
+	result, err := performance(message, annotations, e.statement, e.template, e.redactor)
+	if err != nil {
+		return e.failed(ctx, summary, messageError(PhaseFormat, message.Id, message.ThreadId, err), 0)
+	}
+	e.progress.formatted()
+	err = fn(result)
+	if err != nil {
+		return messageError(PhaseWrite, message.Id, message.ThreadId, err)
+	}
+	summary.Exported++
+	e.progress.written(result.Block)
+	logger.Debug("message exported", "phase", PhaseWrite, "bytes", len(result.Block))
+	return messageError(PhaseIndex, message.Id, message.ThreadId, index.add(message))
+}
+
+// eachConversation is each for the messages in the order of the rebuilt conversations
+func (e *Exporter) eachConversation(ctx context.Context, catalog *tLabelCatalog, index *tDedupIndex, listMessages *tListMessages, summary *TSummary, fn func(TResult) error) error {
+	messages := make([]*gmail.Message, 0, len(listMessages.messages))
+	for _, m := range listMessages.messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		message, attempts, err := e.fetch(ctx, m)
+		if err != nil {
+			err = e.failed(ctx, summary, messageError(PhaseFetch, m.Id, m.ThreadId, err), attempts)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		messages = append(messages, message)
+	}
+	ordered, places := conversations(messages)
+	for _, message := range ordered {
+		annotations := catalog.annotations(message)
+		annotations.Conversation = places[message.Id]
+		err := e.eachMessage(ctx, message, annotations, index, summary, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachThread is each for the threads
+func (e *Exporter) eachThread(ctx context.Context, catalog *tLabelCatalog, index *tDedupIndex, filter TFilter, summary *TSummary, fn func(TResult) error) error {
+	e.progress.start("threads")
+	threads, err := searchThreads(ctx, e.client, e.user, filter, e.progress)
+	summary.Found = len(threads)
+	if err != nil {
+		return messageError(PhaseList, "", "", err)
+	}
+	e.progress.found(summary.Found)
+	e.logger.Debug("threads listed", "phase", PhaseList, "query", filter.Query(), "found", summary.Found)
+	for _, th := range threads {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var thread *gmail.Thread
+		attempts, err := e.retry(ctx, th.Id, func() (err error) {
+			thread, err = fetchThread(ctx, e.client, e.user, th.Id)
+			return err
+		})
+		if err != nil {
+			err = e.failed(ctx, summary, messageError(PhaseFetch, "", th.Id, err), attempts)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		e.progress.fetched()
+		logger := e.logger.With("threadId", thread.Id)
+		logger.Debug("thread fetched", "phase", PhaseFetch, "messages", len(thread.Messages))
+		if index.hasThread(thread) {
+			summary.Duplicates++
+			e.progress.duplicate()
+			logger.Debug("duplicate skipped")
+			continue
+		}
+		result, err := e.formatThread(thread, catalog)
+		if err != nil {
+			err = e.failed(ctx, summary, err, 0)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		e.progress.formatted()
+		err = fn(result)
+		if err != nil {
+			return messageError(PhaseWrite, "", thread.Id, err)
+		}
+		summary.Exported++
+		e.progress.written(result.Block)
+		logger.Debug("thread exported", "phase", PhaseWrite, "bytes", len(result.Block))
+		for _, message := range thread.Messages {
+			err = index.add(message)
+			if err != nil {
+				return messageError(PhaseIndex, message.Id, thread.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// formatThread prepares the messages of the thread and formats the thread
+func (e *Exporter) formatThread(thread *gmail.Thread, catalog *tLabelCatalog) (TResult, error) {
+	result := TResult{Thread: thread}
+	messages := thread.Messages
+	var places map[string]*areas.TConversation
+	if e.statement.Conversations {
+		messages, places = conversations(messages)
+	}
+	prepared := make([]any, len(messages))
+	annotations := make([]areas.TAnnotations, len(messages))
+	for i, message := range messages {
+		var err error
+		annotations[i] = catalog.annotations(message)
+		annotations[i].Conversation = places[message.Id]
+		prepared[i], err = prepareMessage(message, annotations[i], e.statement.Area)
+		if err != nil {
+			return result, messageError(PhaseFormat, message.Id, thread.Id, err)
+		}
+		prepared[i], err = redactMessage(prepared[i], e.redactor)
+		if err != nil {
+			return result, messageError(PhaseFormat, message.Id, thread.Id, err)
+		}
+	}
+	var session *redact.TSession
+	if e.redactor != nil {
+		session = e.redactor.Session()
+	}
+	area := newThread(thread.Id, messages, prepared, session)
+	result.Area = area
+	var err error
+	switch {
+	case e.template != nil:
+		result.Block, err = e.template.render(area)
+	case isRows(e.statement.Format):
+		// A row or record per message of the thread
+		result.Block, result.records, err = toRows(redactGmailMessages(messages, e.redactor), annotations, e.statement)
+	default:
+		result.Block, err = toFormat(area, e.statement.Format)
+	}
+	if err != nil {
+		return result, messageError(PhaseFormat, "", thread.Id, err)
+	}
+	return result, nil
+}
+
+// Export writes the messages to the output defined by the statement and returns how many were written.
+// It returns ErrNothingFound if no messages match the filter; not when all of them are duplicates.
+// When it stops early, for example because ctx is cancelled, the output written so far
+// is closed properly, so a JSON output is still a valid array.
+// The manifest of the export is written after the output is closed, also when it stops early.
+// With the OnError policy "skip" or "retry" the messages that fail are listed in the summary and in
+// the errors file; Export returns ErrAllFailed if all of them failed.
+func (e *Exporter) Export(ctx context.Context) (TSummary, error) {
+	var summary TSummary
+	out, err := newOutput(e.statement)
+	if err != nil {
+		return summary, err
+	}
+	file, err := createManifest(e.statement)
+	if err != nil {
+		out.close()
+		return summary, err
+	}
+	var manifest *TManifest
+	if file != nil {
+		manifest = e.newManifest(ctx, file)
+	}
+	err = e.each(ctx, &summary, func(result TResult) error {
+		location, err := out.write(result)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			manifest.add(result, location)
+		}
+		return nil
+	})
+	e.writeErrors(summary)
+	if manifest != nil {
+		manifest.ResultSizeEstimate = e.resultSizeEstimate
+	}
+	if err != nil {
+		out.close()
+		if manifest != nil && summary.Exported > 0 {
+			if err := manifest.write(summary, err); err != nil {
+				e.logger.Warn("the manifest of the stopped export could not be written", "path", file.Name(), "error", err)
+			}
+		} else if manifest != nil {
+			manifest.discard()
+		}
+		return summary, err
+	}
+	if summary.Exported == 0 && summary.Duplicates == 0 {
+		out.close()
+		if len(summary.Failed) > 0 {
+			// The failures are recorded in an incomplete manifest
+			if manifest != nil {
+				if err := manifest.write(summary, ErrAllFailed); err != nil {
+					e.logger.Warn("the manifest of the failed export could not be written", "path", file.Name(), "error", err)
+				}
+			}
+			return summary, ErrAllFailed
+		}
+		if manifest != nil {
+			manifest.discard()
+		}
+		return summary, ErrNothingFound
+	}
+	err = out.close()
+	if err != nil || manifest == nil {
+		if manifest != nil {
+			manifest.discard()
+		}
+		return summary, err
+	}
+	return summary, manifest.write(summary, nil)
+}
@@ -0,0 +1,181 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmailexport/app/areas"
+	"gmailexport/app/gmailapi/fake"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// newTestMailbox returns a mailbox with n messages, the newest one first in the list
+func newTestMailbox(t *testing.T, n int) *fake.Mailbox {
+	mailbox := fake.New()
+	for i := 1; i <= n; i++ {
+		raw := fmt.Sprintf("From: sender%d@example.com\r\nTo: me@example.com\r\nSubject: Message %d\r\n"+
+			"Date: Mon, %d May 2021 10:00:00 +0000\r\nMessage-ID: <%d@example.com>\r\n\r\nBody %d\r\n", i, i, i, i, i)
+		message, err := fake.ParseMessage([]byte(raw))
+		require.NoError(t, err)
+		message.Id = fmt.Sprint(i)
+		mailbox.AddMessage(message)
+	}
+	return mailbox
+}
+
+// attachmentMessage returns a message with the subject, a text part and a PDF attachment
+func attachmentMessage(t *testing.T, subject string) *gmail.Message {
+	message, err := fake.ParseMessage([]byte("From: a@example.com\r\nSubject: " + subject + "\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nAttached.\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=invoice.pdf\r\n\r\nPDF\r\n--b--\r\n"))
+	require.NoError(t, err)
+	return message
+}
+
+// readJson reads the messages written to a JSON file
+func readJson(t *testing.T, path string) []map[string]interface{} {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var messages []map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &messages))
+	return messages
+}
+
+func TestExport(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small"}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 2, Exported: 2}, summary)
+
+	messages := readJson(t, path)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "2", messages[0]["id"])
+	assert.Equal(t, "Message 2", messages[0]["subject"])
+	assert.Equal(t, "Body 1\r\n", messages[1]["plainText"])
+}
+
+// Test the filter is passed to Gmail as a query
+func TestExportFilter(t *testing.T) {
+	mailbox := newTestMailbox(t, 3)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{From: "sender2@example.com"}, TStatement{Output: path, Format: "json", Area: "raw"}).Export(context.Background())
+	require.NoError(t, err)
+
+	messages := readJson(t, path)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "2", messages[0]["id"])
+	assert.Contains(t, messages[0]["raw"], "Subject: Message 2")
+}
+
+// Test all pages of the search result are exported
+func TestExportPages(t *testing.T) {
+	mailbox := newTestMailbox(t, 5)
+	mailbox.PageSize = 2
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw"}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.Exported)
+	assert.Equal(t, 3, mailbox.Calls("ListMessages"))
+	assert.Len(t, readJson(t, path), 5)
+}
+
+func TestExportSplit(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+	dir := t.TempDir()
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: filepath.Join(dir, "gmail.txt"), Split: true, Format: "txt", Area: "small"}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "gmail_1.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "Subject: Message 1\r\n")
+}
+
+func TestExportNothingFound(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+
+	_, err := NewWithClient(mailbox, "me", TFilter{Subject: "missing"}, TStatement{Output: "stdout", Format: "json", Area: "raw"}).Export(context.Background())
+	assert.ErrorIs(t, err, ErrNothingFound)
+}
+
+// Test an error of Gmail stops the export and is returned
+func TestExportError(t *testing.T) {
+	mailbox := newTestMailbox(t, 3)
+	failure := errors.New("backend error")
+	mailbox.FailOn("GetMessage", "2", 0, failure)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw"}).Export(context.Background())
+	assert.ErrorIs(t, err, failure)
+	var exportErr *TError
+	require.ErrorAs(t, err, &exportErr)
+	assert.Equal(t, PhaseFetch, exportErr.Phase)
+	assert.Equal(t, "2", exportErr.MessageId)
+	assert.Equal(t, TSummary{Found: 3, Exported: 1}, summary)
+	assert.Len(t, readJson(t, path), 1)
+}
+
+// tCancellingClient cancels the context when a message is requested
+type tCancellingClient struct {
+	*fake.Mailbox
+	id     string
+	cancel context.CancelFunc
+}
+
+func (c tCancellingClient) GetMessage(ctx context.Context, user, id, format string) (*gmail.Message, error) {
+	if id == c.id {
+		c.cancel()
+	}
+	return c.Mailbox.GetMessage(ctx, user, id, format)
+}
+
+// Test a cancelled export leaves a valid JSON array with the messages written so far
+func TestExportCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := tCancellingClient{Mailbox: newTestMailbox(t, 3), id: "2", cancel: cancel}
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(client, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw"}).Export(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, TSummary{Found: 3, Exported: 1}, summary)
+	assert.Equal(t, 2, summary.Remaining())
+	assert.Len(t, readJson(t, path), 1)
+}
+
+func TestEach(t *testing.T) {
+	mailbox := newTestMailbox(t, 3)
+	var ids []string
+
+	err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Format: "json", Area: "easy"}).Each(context.Background(), func(result TResult) error {
+		ids = append(ids, result.Message.Id)
+		assert.NotEmpty(t, result.Block)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, ids)
+}
+
+func TestExportCustomArea(t *testing.T) {
+	fields, err := areas.ParseFields("id,subject=header:Subject")
+	require.NoError(t, err)
+	require.NoError(t, areas.Define(areas.TAreaDefinition{Name: "subjects", Fields: fields}))
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	_, err = NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "subjects"}).Export(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id":"2","subject":"Message 2"},{"id":"1","subject":"Message 1"}]`, string(b))
+}
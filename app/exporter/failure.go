@@ -0,0 +1,136 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// OnErrors are the values of TStatement.OnError: "fail" stops the export at the first error,
+// "skip" skips a message that cannot be fetched or formatted, and "retry" fetches it again
+// before skipping it. Errors writing the output always stop the export.
+var OnErrors = []string{"fail", "skip", "retry"}
+
+// ErrorsSuffix replaces the extension of the output in the name of the errors file of an export
+const ErrorsSuffix = ".errors.ndjson"
+
+// ErrAllFailed is returned by Export when every message found was skipped on error
+var ErrAllFailed = errors.New("every message failed")
+
+// retryAttempts is the number of times a message is fetched with the OnError policy "retry"
+const retryAttempts = 3
+
+// retryDelay is the wait before the second attempt, doubled before each next one
+var retryDelay = time.Second
+
+// TFailure is a message (or a thread, when exporting by thread) skipped on error, a line of the errors file
+type TFailure struct {
+	Id       string `json:"id,omitempty"`
+	ThreadId string `json:"threadId,omitempty"`
+	Phase    string `json:"phase"`
+	Error    string `json:"error"`
+	// Attempts: the number of times the message was fetched.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// skips reports whether the statement skips the messages that fail
+func (e *Exporter) skips() bool {
+	return e.statement.OnError == "skip" || e.statement.OnError == "retry"
+}
+
+// retry calls get, and with the OnError policy "retry" calls it again after a transient failure, up to
+// retryAttempts times in all. It returns the number of calls and the last error.
+func (e *Exporter) retry(ctx context.Context, id string, get func() error) (int, error) {
+	err := get()
+	attempts, delay := 1, retryDelay
+	for ; err != nil && e.statement.OnError == "retry" && transient(err) && ctx.Err() == nil && attempts < retryAttempts; attempts++ {
+		e.logger.Info("retrying", "id", id, "phase", PhaseFetch, "attempt", attempts+1, "error", err)
+		select {
+		case <-ctx.Done():
+			return attempts, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+		err = get()
+	}
+	return attempts, err
+}
+
+// transient reports whether a call that failed with err may succeed when repeated: Gmail's rate
+// limit (429), server errors (5xx) and network errors. Errors such as 404 or 400 are permanent.
+func transient(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// failed applies the OnError policy to the error of a message: when the statement skips the messages
+// that fail, a fetch or format error is recorded in the summary and nil is returned, so that the export
+// goes on with the next message. Other errors and errors after ctx is done are returned as they are.
+func (e *Exporter) failed(ctx context.Context, summary *TSummary, err error, attempts int) error {
+	var exportErr *TError
+	if !e.skips() || ctx.Err() != nil || !errors.As(err, &exportErr) || exportErr.Phase != PhaseFetch && exportErr.Phase != PhaseFormat {
+		return err
+	}
+	summary.Failed = append(summary.Failed, TFailure{
+		Id:       exportErr.MessageId,
+		ThreadId: exportErr.ThreadId,
+		Phase:    exportErr.Phase,
+		Error:    exportErr.Err.Error(),
+		Attempts: attempts,
+	})
+	e.progress.failed()
+	e.logger.Warn("skipped", "error", exportErr)
+	return nil
+}
+
+// errorsPath returns the path of the errors file of the statement, "" for none: by default the output
+// without its extension followed by ErrorsSuffix, none when writing to stdout or with the policy "fail".
+func errorsPath(statement TStatement) string {
+	if statement.OnError != "skip" && statement.OnError != "retry" {
+		return ""
+	}
+	if statement.ErrorsFile != "" {
+		return statement.ErrorsFile
+	}
+	return sidecarPath(statement, ErrorsSuffix)
+}
+
+// writeErrors writes the errors file of an export that found messages, so that no errors file is left
+// by an export that stopped before or found nothing
+func (e *Exporter) writeErrors(summary TSummary) {
+	path := errorsPath(e.statement)
+	if path == "" || summary.Found == 0 && len(summary.Failed) == 0 {
+		return
+	}
+	if err := writeFailures(path, summary.Failed); err != nil {
+		e.logger.Warn("the errors file could not be written", "path", path, "error", err)
+	}
+}
+
+// writeFailures writes the failures to path as JSON lines. The file is written, empty, also without
+// failures, so that it never lists the failures of a previous export.
+func writeFailures(path string, failures []TFailure) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, failure := range failures {
+		err = encoder.Encode(failure)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
@@ -0,0 +1,160 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"gmailexport/app/gmailapi/fake"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+// newMalformedMailbox returns the mailbox of newTestMailbox(t, 3) with a raw body that is not base64 in message 2
+func newMalformedMailbox(t *testing.T) *fake.Mailbox {
+	mailbox := newTestMailbox(t, 3)
+	message, err := mailbox.GetMessage(context.Background(), "me", "2", "full")
+	require.NoError(t, err)
+	message.Raw = "not base64!"
+	mailbox.DeleteMessage("2")
+	mailbox.AddMessage(message)
+	return mailbox
+}
+
+// readFailures reads the lines of an errors file
+func readFailures(t *testing.T, path string) []TFailure {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	failures := []TFailure{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var failure TFailure
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &failure))
+		failures = append(failures, failure)
+	}
+	require.NoError(t, scanner.Err())
+	return failures
+}
+
+func TestExportFailsOnMalformedMessage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+
+	summary, err := NewWithClient(newMalformedMailbox(t), "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw"}).Export(context.Background())
+	var exportErr *TError
+	require.ErrorAs(t, err, &exportErr)
+	assert.Equal(t, PhaseFormat, exportErr.Phase)
+	assert.Equal(t, "2", exportErr.MessageId)
+	assert.Equal(t, 1, summary.Exported)
+	assert.NoFileExists(t, filepath.Join(dir, "out"+ErrorsSuffix))
+}
+
+func TestExportSkip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+
+	summary, err := NewWithClient(newMalformedMailbox(t), "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw", OnError: "skip"}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Exported)
+	require.Len(t, summary.Failed, 1)
+	assert.Equal(t, "2", summary.Failed[0].Id)
+	assert.Equal(t, PhaseFormat, summary.Failed[0].Phase)
+	assert.Equal(t, 0, summary.Remaining())
+	assert.Len(t, readJson(t, path), 2)
+	assert.Equal(t, summary.Failed, readFailures(t, filepath.Join(dir, "out"+ErrorsSuffix)))
+
+	b, err := os.ReadFile(filepath.Join(dir, "out"+ManifestSuffix))
+	require.NoError(t, err)
+	var manifest TManifest
+	require.NoError(t, json.Unmarshal(b, &manifest))
+	assert.True(t, manifest.Complete)
+	assert.Equal(t, summary.Failed, manifest.Failed)
+	problems, err := Verify(filepath.Join(dir, "out"+ManifestSuffix))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1 messages were skipped on error"}, problems)
+}
+
+// Test the errors file of an export without failures is written empty
+func TestExportSkipWithoutFailures(t *testing.T) {
+	dir := t.TempDir()
+	errorsFile := filepath.Join(dir, "errors.ndjson")
+	require.NoError(t, os.WriteFile(errorsFile, []byte(`{"id":"old","phase":"fetch","error":"old"}`+"\n"), 0644))
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, TStatement{Output: filepath.Join(dir, "out.json"), Format: "json", Area: "raw", OnError: "skip", ErrorsFile: errorsFile}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, readFailures(t, errorsFile))
+}
+
+func TestExportAllFailed(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+	mailbox.FailOn("GetMessage", "", 0, errors.New("backend error"))
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw", OnError: "skip"}).Export(context.Background())
+	assert.ErrorIs(t, err, ErrAllFailed)
+	assert.Len(t, summary.Failed, 2)
+	assert.NoFileExists(t, path)
+	assert.Len(t, readFailures(t, filepath.Join(filepath.Dir(path), "out"+ErrorsSuffix)), 2)
+
+	manifest := readManifest(t, filepath.Join(filepath.Dir(path), "out"+ManifestSuffix))
+	assert.False(t, manifest.Complete)
+	assert.Equal(t, ErrAllFailed.Error(), manifest.Error)
+	assert.Equal(t, summary.Failed, manifest.Failed)
+}
+
+// Test no errors file is written by an export that did not start or found nothing
+func TestExportErrorsFileNotStarted(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "out.json"), Format: "json", Area: "raw", OnError: "skip", Append: true}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.Error(t, err)
+	statement.Append = false
+	_, err = NewWithClient(newTestMailbox(t, 0), "me", TFilter{}, statement).Export(context.Background())
+	assert.ErrorIs(t, err, ErrNothingFound)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExportRetry(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Millisecond
+	mailbox := newTestMailbox(t, 3)
+	failure := &googleapi.Error{Code: 503, Message: "backend error"}
+	mailbox.FailOn("GetMessage", "2", 2, failure)
+	mailbox.FailOn("GetMessage", "3", 0, failure)
+	// A permanent error is not retried
+	mailbox.FailOn("GetMessage", "1", 1, &googleapi.Error{Code: 404, Message: "not found"})
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "raw", OnError: "retry"}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Exported)
+	assert.Equal(t, []TFailure{
+		{Id: "3", ThreadId: "3", Phase: PhaseFetch, Error: failure.Error(), Attempts: retryAttempts},
+		{Id: "1", ThreadId: "1", Phase: PhaseFetch, Error: "googleapi: Error 404: not found", Attempts: 1},
+	}, summary.Failed)
+}
+
+func TestExportSkipThread(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	threads, err := mailbox.ListThreads(context.Background(), "me", "", "")
+	require.NoError(t, err)
+	mailbox.FailOn("GetThread", threads.Threads[0].Id, 0, errors.New("backend error"))
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small", ByThread: true, OnError: "skip"}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, len(threads.Threads)-1, summary.Exported)
+	require.Len(t, summary.Failed, 1)
+	assert.Equal(t, threads.Threads[0].Id, summary.Failed[0].ThreadId)
+}
@@ -0,0 +1,67 @@
+package exporter
+
+// TFilter represents the filter options for searching Gmail messages
+type TFilter struct {
+	MessageId string
+	Label     string
+	From      string
+	To        string
+	Subject   string
+}
+
+// Query constructs a Gmail search query string from the filter options
+func (filter TFilter) Query() string {
+	ss := []string{filter.messageId(), filter.label(), filter.from(), filter.to(), filter.subject()}
+	q := ""
+	for _, s := range ss {
+		if s != "" {
+			if q == "" {
+				q = s
+			} else {
+				q = q + " AND " + s
+			}
+		}
+	}
+	return q
+}
+
+// Helper methods to construct individual query parts
+func (filter TFilter) messageId() string {
+	s := ""
+	if filter.MessageId != "" {
+		s = "rfc822msgid:" + filter.MessageId
+	}
+	return s
+}
+
+func (filter TFilter) label() string {
+	s := ""
+	if filter.Label != "" {
+		s = "label:" + filter.Label
+	}
+	return s
+}
+
+func (filter TFilter) from() string {
+	s := ""
+	if filter.From != "" {
+		s = "from:" + filter.From
+	}
+	return s
+}
+
+func (filter TFilter) to() string {
+	s := ""
+	if filter.To != "" {
+		s = "to:" + filter.To
+	}
+	return s
+}
+
+func (filter TFilter) subject() string {
+	s := ""
+	if filter.Subject != "" {
+		s = "subject:" + filter.Subject
+	}
+	return s
+}
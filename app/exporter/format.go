@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/areas"
+	"sort"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// tFormat is an output format of the registry. A format either encodes each prepared message
+// (or thread, or label), so that it works with any area, or converts the Gmail messages to rows
+// or to records independently of the area, and then only takes the area "all".
+type tFormat struct {
+	name        string
+	description string
+	// encode converts a prepared message, thread or label to a block of the format.
+	encode func(v any) ([]byte, error)
+	// rows converts messages to a block of rows, for the formats without encode.
+	rows func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) ([]byte, error)
+	// records converts messages to the records the output of the format writes, such as []TParquetMessage,
+	// for the formats that write their own files.
+	records func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) (any, error)
+	// open returns the output of the format; without it the blocks are written to single or split files.
+	open func(statement TStatement) (iOutput, error)
+	// header returns what starts every file of the format.
+	header func(statement TStatement) (string, error)
+	// coma, leftBracket and rightBracket join the blocks written to a single file.
+	coma, leftBracket, rightBracket string
+	// appendable: the blocks can be appended to an existing file.
+	appendable bool
+	// updates: every export updates the same output, such as a database.
+	updates bool
+	// extension: the extension of the files of the format, "." and the name by default.
+	extension string
+}
+
+// formats holds the output formats by name
+var formats = map[string]*tFormat{}
+
+// registerFormat adds an output format to the registry
+func registerFormat(format tFormat) {
+	if _, ok := formats[format.name]; ok {
+		panic(fmt.Sprintf("format %q registered twice", format.name))
+	}
+	if format.extension == "" {
+		format.extension = "." + format.name
+	}
+	formats[format.name] = &format
+}
+
+// lookupFormat returns the registered format with the name
+func lookupFormat(name string) (*tFormat, error) {
+	format, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+	return format, nil
+}
+
+// TFormat describes a registered output format
+type TFormat struct {
+	Name        string
+	Description string
+	// Area: the format writes the messages prepared according to the area, and can write labels.
+	// The other formats only take the area "all".
+	Area bool
+}
+
+// Formats returns the registered output formats sorted by name
+func Formats() []TFormat {
+	list := make([]TFormat, 0, len(formats))
+	for _, format := range formats {
+		list = append(list, TFormat{Name: format.name, Description: format.description, Area: format.encode != nil})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func init() {
+	registerFormat(tFormat{
+		name:         "json",
+		description:  "a JSON array of the messages prepared according to the area",
+		encode:       json.Marshal,
+		coma:         ",",
+		leftBracket:  "[",
+		rightBracket: "]",
+	})
+	registerFormat(tFormat{
+		name:        "ndjson",
+		description: "a JSON object per line (JSON Lines), which can be streamed and appended to",
+		encode: func(v any) ([]byte, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return append(b, '\n'), nil
+		},
+		appendable: true,
+	})
+	registerFormat(tFormat{
+		name:         "txt",
+		description:  "plain text, the messages between Begin Message and End Message lines",
+		encode:       toTxt,
+		coma:         "=== End Message ===\r\n\r\n\r\n=== Begin Message ===\r\n",
+		leftBracket:  "=== Begin Message ===\r\n",
+		rightBracket: "=== End Message ===\r\n",
+	})
+}
+
+// toTxt converts a prepared message, thread or label to plain text with its ToTxt method,
+// or else its String method
+func toTxt(v any) ([]byte, error) {
+	switch t := v.(type) {
+	case interface{ ToTxt() ([]byte, error) }:
+		return t.ToTxt()
+	case fmt.Stringer:
+		return []byte(t.String()), nil
+	default:
+		return nil, fmt.Errorf("%T has no plain text form", v)
+	}
+}
@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"context"
+	"gmailexport/app/areas"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// tSubjectArea is an area without ToJson and ToTxt methods
+type tSubjectArea struct {
+	Subject string `json:"subject"`
+}
+
+func (a tSubjectArea) String() string {
+	return "Subject: " + a.Subject + "\r\n"
+}
+
+func TestFormats(t *testing.T) {
+	var names []string
+	for _, format := range Formats() {
+		names = append(names, format.Name)
+		assert.NotEmpty(t, format.Description, format.Name)
+		assert.Equal(t, format.Name == "json" || format.Name == "ndjson" || format.Name == "txt", format.Area, format.Name)
+	}
+	assert.Equal(t, []string{"csv", "html", "json", "markdown", "ndjson", "parquet", "pdf", "sqlite", "tsv", "txt"}, names)
+
+	_, err := lookupFormat("xml")
+	assert.EqualError(t, err, `unknown format "xml"`)
+}
+
+// Test a registered area is written by the formats without implementing them
+func TestExportRegisteredArea(t *testing.T) {
+	require.NoError(t, areas.Register(areas.TArea{
+		Name: "subject",
+		// Not nil, so that the area can be registered again when the test is repeated
+		Fields: []areas.TField{},
+		Prepare: func(m *gmail.Message, annotations areas.TAnnotations) (any, error) {
+			return tSubjectArea{Subject: messageHeader(m, "Subject")}, nil
+		},
+	}))
+
+	for format, expected := range map[string]string{
+		"json":   `[{"subject":"Message 2"},{"subject":"Message 1"}]`,
+		"ndjson": "{\"subject\":\"Message 2\"}\n{\"subject\":\"Message 1\"}\n",
+		"txt":    "=== Begin Message ===\r\nSubject: Message 2\r\n=== End Message ===\r\n\r\n\r\n=== Begin Message ===\r\nSubject: Message 1\r\n=== End Message ===\r\n",
+	} {
+		// A directory for each format, since the outputs would share their manifest
+		path := filepath.Join(t.TempDir(), "out."+format)
+		_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, TStatement{Output: path, Format: format, Area: "subject"}).Export(context.Background())
+		require.NoError(t, err)
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(b), format)
+	}
+}
@@ -0,0 +1,157 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/areas"
+	"gmailexport/app/gmailapi"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// TLabel describes a label of the mailbox
+type TLabel struct {
+	// Id: The immutable ID of the label.
+	Id string `json:"id"`
+	// Name: The display name of the label. Names of nested labels are paths such as "Work/Clients".
+	Name string `json:"name"`
+	// Path: The name split into the names of the parent labels and the label itself.
+	Path []string `json:"path"`
+	// Type: "system" for labels created by Gmail, "user" for labels created by the user.
+	Type string `json:"type"`
+	// MessagesTotal: The total number of messages with the label.
+	MessagesTotal int64 `json:"messagesTotal"`
+	// MessagesUnread: The number of unread messages with the label.
+	MessagesUnread int64 `json:"messagesUnread"`
+	// ThreadsTotal: The total number of threads with the label.
+	ThreadsTotal int64 `json:"threadsTotal"`
+	// ThreadsUnread: The number of unread threads with the label.
+	ThreadsUnread int64 `json:"threadsUnread"`
+	// TextColor: The text color of the label as a hex string, if set.
+	TextColor string `json:"textColor,omitempty"`
+	// BackgroundColor: The background color of the label as a hex string, if set.
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+}
+
+// Labels returns the label catalogue of the mailbox with the message and thread counts and colours
+func Labels(ctx context.Context, client gmailapi.IClient, user string) ([]TLabel, error) {
+	list, err := client.ListLabels(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]TLabel, 0, len(list.Labels))
+	for _, l := range list.Labels {
+		// Only labels.get returns the counts
+		label, err := client.GetLabel(ctx, user, l.Id)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, newLabel(label))
+	}
+	return labels, nil
+}
+
+// newLabel converts a Gmail label to TLabel
+func newLabel(label *gmail.Label) TLabel {
+	l := TLabel{
+		Id:             label.Id,
+		Name:           label.Name,
+		Path:           strings.Split(label.Name, "/"),
+		Type:           label.Type,
+		MessagesTotal:  label.MessagesTotal,
+		MessagesUnread: label.MessagesUnread,
+		ThreadsTotal:   label.ThreadsTotal,
+		ThreadsUnread:  label.ThreadsUnread,
+	}
+	if label.Color != nil {
+		l.TextColor = label.Color.TextColor
+		l.BackgroundColor = label.Color.BackgroundColor
+	}
+	return l
+}
+
+// String method returns a formatted string representation of TLabel
+func (l TLabel) String() string {
+	St := ""
+	St = St + fmt.Sprintf("%s: %s\r\n", "ID", l.Id)
+	St = St + fmt.Sprintf("%s: %s\r\n", "Name", l.Name)
+	St = St + fmt.Sprintf("%s: %s\r\n", "Type", l.Type)
+	St = St + fmt.Sprintf("%s: %v (%v unread)\r\n", "Messages", l.MessagesTotal, l.MessagesUnread)
+	St = St + fmt.Sprintf("%s: %v (%v unread)\r\n", "Threads", l.ThreadsTotal, l.ThreadsUnread)
+	if l.TextColor != "" || l.BackgroundColor != "" {
+		St = St + fmt.Sprintf("%s: %s on %s\r\n", "Color", l.TextColor, l.BackgroundColor)
+	}
+	return St
+}
+
+// ToJson method converts the TLabel structure to a JSON byte array.
+func (l TLabel) ToJson() ([]byte, error) {
+	b, err := json.Marshal(l)
+	return b, err
+}
+
+// ToTxt method converts the TLabel structure to a plain text byte array.
+func (l TLabel) ToTxt() ([]byte, error) {
+	b := []byte(l.String())
+	return b, nil
+}
+
+// tLabelCatalog resolves label IDs and names of the mailbox
+type tLabelCatalog struct {
+	names areas.TLabels
+	user  map[string]bool
+}
+
+// loadLabelCatalog lists the labels of the mailbox
+func loadLabelCatalog(ctx context.Context, client gmailapi.IClient, user string) (*tLabelCatalog, error) {
+	list, err := client.ListLabels(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &tLabelCatalog{names: make(areas.TLabels), user: make(map[string]bool)}
+	for _, l := range list.Labels {
+		catalog.names[l.Id] = l.Name
+		catalog.user[l.Id] = l.Type == "user"
+	}
+	return catalog, nil
+}
+
+// annotations returns the information about the message resolved with the catalog
+func (catalog *tLabelCatalog) annotations(message *gmail.Message) areas.TAnnotations {
+	return areas.TAnnotations{LabelNames: catalog.names.Names(message.LabelIds)}
+}
+
+// queryName returns how the user label, given by ID or by name in any case, is written in a Gmail query:
+// the name in lower case with spaces and slashes replaced by dashes.
+// System and unknown labels are returned as they are.
+func (catalog *tLabelCatalog) queryName(label string) string {
+	for id, name := range catalog.names {
+		if catalog.user[id] && (id == label || strings.EqualFold(name, label)) {
+			return strings.NewReplacer(" ", "-", "/", "-").Replace(strings.ToLower(name))
+		}
+	}
+	return label
+}
+
+// WriteLabels writes the labels to the output defined by the statement, like the messages of an export
+func WriteLabels(labels []TLabel, statement TStatement) error {
+	out, err := newOutput(statement)
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		block, err := toFormat(label, statement.Format)
+		if err != nil {
+			out.close()
+			return err
+		}
+		_, err = out.write(TResult{Block: block})
+		if err != nil {
+			out.close()
+			return err
+		}
+	}
+	return out.close()
+}
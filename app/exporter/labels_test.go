@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestLabels(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+	id := mailbox.AddLabel(&gmail.Label{Name: "Work/Clients", Color: &gmail.LabelColor{TextColor: "#ffffff", BackgroundColor: "#000000"}})
+	mailbox.ModifyLabels("1", []string{id, "UNREAD"}, nil)
+
+	labels, err := Labels(context.Background(), mailbox, "me")
+	require.NoError(t, err)
+	label := labels[len(labels)-1]
+	assert.Equal(t, TLabel{
+		Id:              id,
+		Name:            "Work/Clients",
+		Path:            []string{"Work", "Clients"},
+		Type:            "user",
+		MessagesTotal:   1,
+		MessagesUnread:  1,
+		ThreadsTotal:    1,
+		ThreadsUnread:   1,
+		TextColor:       "#ffffff",
+		BackgroundColor: "#000000",
+	}, label)
+	assert.Equal(t, "ID: "+id+"\r\nName: Work/Clients\r\nType: user\r\nMessages: 1 (1 unread)\r\nThreads: 1 (1 unread)\r\nColor: #ffffff on #000000\r\n", label.String())
+
+	path := filepath.Join(t.TempDir(), "labels.json")
+	require.NoError(t, WriteLabels(labels, TStatement{Output: path, Format: "json"}))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"name":"Work/Clients","path":["Work","Clients"]`)
+}
+
+// Test label names are exported with the IDs, and the label filter accepts names
+func TestExportLabelNames(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+	id := mailbox.AddLabel(&gmail.Label{Name: "My Project/Docs"})
+	mailbox.ModifyLabels("2", []string{id}, nil)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{Label: "my project/docs"}, TStatement{Output: path, Format: "json", Area: "easy"}).Export(context.Background())
+	require.NoError(t, err)
+
+	messages := readJson(t, path)
+	require.Len(t, messages, 1)
+	assert.Equal(t, []interface{}{"INBOX", id}, messages[0]["labelIds"])
+	assert.Equal(t, []interface{}{"INBOX", "My Project/Docs"}, messages[0]["labelNames"])
+}
+
+func TestLabelCatalogQueryName(t *testing.T) {
+	mailbox := newTestMailbox(t, 0)
+	id := mailbox.AddLabel(&gmail.Label{Name: "My Project/Docs"})
+	catalog, err := loadLabelCatalog(context.Background(), mailbox, "me")
+	require.NoError(t, err)
+
+	assert.Equal(t, "my-project-docs", catalog.queryName("My Project/Docs"))
+	assert.Equal(t, "my-project-docs", catalog.queryName(id))
+	assert.Equal(t, "INBOX", catalog.queryName("INBOX"))
+	assert.Equal(t, "unknown", catalog.queryName("unknown"))
+}
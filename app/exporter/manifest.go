@@ -0,0 +1,578 @@
+package exporter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Version is the version of the tool recorded in the manifests, set when building with
+// -ldflags "-X gmailexport/app/exporter.Version=v1.2.3"
+var Version = "dev"
+
+// ManifestSuffix replaces the extension of the output in the name of the manifest of an export
+const ManifestSuffix = ".manifest.json"
+
+// TManifest describes an export, so that Verify can show it is complete and unmodified
+type TManifest struct {
+	// Tool and Version: the tool that wrote the export.
+	Tool    string `json:"tool"`
+	Version string `json:"version"`
+	// Created: when the export started.
+	Created time.Time `json:"created"`
+	// Account: the email address of the mailbox.
+	Account string `json:"account"`
+	// Query: the Gmail search query of the filter.
+	Query    string `json:"query"`
+	Format   string `json:"format"`
+	Template string `json:"template,omitempty"`
+	Area     string `json:"area"`
+	ByThread bool   `json:"byThread,omitempty"`
+	// ResultSizeEstimate: Gmail's estimate of the number of messages that match the query,
+	// to compare with Found; 0 when exporting by thread.
+	ResultSizeEstimate int64 `json:"resultSizeEstimate"`
+	// Found, Exported, Duplicates and Failed: the TSummary of the export.
+	Found      int        `json:"found"`
+	Exported   int        `json:"exported"`
+	Duplicates int        `json:"duplicates"`
+	Failed     []TFailure `json:"failed,omitempty"`
+	// Complete: the export was not stopped by an error or an interruption; Error tells why it was.
+	Complete bool   `json:"complete"`
+	Error    string `json:"error,omitempty"`
+	// Files: the output files, relative to the directory of the manifest.
+	Files []TManifestFile `json:"files"`
+	// Messages: the exported messages in the order they were written.
+	Messages []TManifestMessage `json:"messages"`
+
+	// file is where the manifest is written; encrypted leaves out the digests of the messages
+	file      *os.File
+	encrypted bool
+}
+
+// TManifestFile is an output file with its size and the SHA-256 of its content, in hex
+type TManifestFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	Sha256 string `json:"sha256"`
+}
+
+// TManifestMessage is an exported message with its file (and archive entry), and the offset, size and
+// SHA-256 of what was written for it in the content of the file or entry, before compression: its block
+// in a single file, the whole file or entry in a split export. The messages of a thread exported by thread
+// share the block of the thread.
+// The offset, size and SHA-256 are left out for the formats that write their files as a whole (parquet,
+// sqlite, and markdown, html and pdf in a single file), and out of encrypted exports, since the manifest
+// is not encrypted and the digest of a plain text block would confirm a guess of its content.
+type TManifestMessage struct {
+	Id       string `json:"id"`
+	ThreadId string `json:"threadId"`
+	File     string `json:"file"`
+	Entry    string `json:"entry,omitempty"`
+	Offset   int64  `json:"offset,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	Sha256   string `json:"sha256,omitempty"`
+}
+
+// manifestPath returns the path of the manifest of the statement, "" for none: by default the output
+// without its extension followed by ManifestSuffix, none when writing to stdout.
+func manifestPath(statement TStatement) string {
+	if statement.Manifest != "" {
+		return statement.Manifest
+	}
+	return sidecarPath(statement, ManifestSuffix)
+}
+
+// sidecarPath returns the path of a file written next to the output: the output without its
+// compression and extension followed by the suffix, "" when writing to stdout
+func sidecarPath(statement TStatement, suffix string) string {
+	statement, err := resolveCompression(statement)
+	if err != nil || statement.Output == "stdout" {
+		return ""
+	}
+	return strings.TrimSuffix(statement.Output, filepath.Ext(statement.Output)) + suffix
+}
+
+// createManifest creates the manifest file of the statement before anything is written, nil for none.
+// The manifest of an earlier export is never replaced: an existing manifest is an error, except that
+// the default manifest of an export appended, deduplicated or updating the output of an earlier one
+// is numbered after the existing ones, like the split files.
+func createManifest(statement TStatement) (*os.File, error) {
+	path := manifestPath(statement)
+	if path == "" {
+		return nil, nil
+	}
+	numbered := statement.Append || statement.Dedup != ""
+	if format, err := lookupFormat(statement.Format); err == nil && format.updates {
+		numbered = true
+	}
+	numbered = numbered && statement.Manifest == ""
+	for n := 1; ; n++ {
+		file, err := os.OpenFile(path, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0644)
+		if !numbered || !os.IsExist(err) {
+			return file, err
+		}
+		path = strings.TrimSuffix(manifestPath(statement), ManifestSuffix) + "_" + strconv.Itoa(n) + ManifestSuffix
+	}
+}
+
+// newManifest returns the manifest of the export to be written to the file, before the messages are written
+func (e *Exporter) newManifest(ctx context.Context, file *os.File) *TManifest {
+	account := e.user
+	profile, err := e.client.GetProfile(ctx, e.user)
+	if err == nil {
+		account = profile.EmailAddress
+	}
+	return &TManifest{
+		Tool:     "gmailexport",
+		Version:  Version,
+		Created:  time.Now().UTC(),
+		Account:  account,
+		Query:    e.filter.Query(),
+		Format:   e.statement.Format,
+		Template: e.statement.Template,
+		Area:     e.statement.Area,
+		ByThread: e.statement.ByThread,
+
+		file:      file,
+		encrypted: len(e.statement.EncryptTo) > 0,
+	}
+}
+
+// add records the messages of the result written at the location; the files are recorded relative
+// to the directory of the manifest
+func (m *TManifest) add(result TResult, location tLocation) {
+	file := location.file
+	if file != "stdout" {
+		if rel, err := filepath.Rel(filepath.Dir(m.file.Name()), file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		if len(m.Files) == 0 || m.Files[len(m.Files)-1].Path != file {
+			m.Files = append(m.Files, TManifestFile{Path: file})
+		}
+	}
+	messages := []*gmail.Message{result.Message}
+	if result.Message == nil {
+		messages = result.Thread.Messages
+	}
+	for _, message := range messages {
+		entry := TManifestMessage{
+			Id:       message.Id,
+			ThreadId: message.ThreadId,
+			File:     file,
+			Entry:    location.entry,
+		}
+		if !m.encrypted && location.sha256 != "" {
+			entry.Offset = location.offset
+			entry.Bytes = location.bytes
+			entry.Sha256 = location.sha256
+		}
+		m.Messages = append(m.Messages, entry)
+	}
+}
+
+// write completes the manifest with the summary, the error that stopped the export and the digests
+// of the files, which are closed by now, and writes it to its file
+func (m *TManifest) write(summary TSummary, exportErr error) error {
+	m.Found = summary.Found
+	m.Exported = summary.Exported
+	m.Duplicates = summary.Duplicates
+	m.Failed = summary.Failed
+	m.Complete = exportErr == nil
+	if exportErr != nil {
+		m.Error = exportErr.Error()
+	}
+	if m.Files == nil {
+		m.Files = []TManifestFile{}
+	}
+	if m.Messages == nil {
+		m.Messages = []TManifestMessage{}
+	}
+	dir := filepath.Dir(m.file.Name())
+	for i, f := range m.Files {
+		var err error
+		m.Files[i].Bytes, m.Files[i].Sha256, err = fileDigest(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			m.file.Close()
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		m.file.Close()
+		return err
+	}
+	_, err = m.file.Write(append(b, '\n'))
+	if err != nil {
+		m.file.Close()
+		return err
+	}
+	return m.file.Close()
+}
+
+// discard removes the manifest file of an export that wrote nothing
+func (m *TManifest) discard() error {
+	m.file.Close()
+	return os.Remove(m.file.Name())
+}
+
+// fileDigest returns the size of the file and the SHA-256 of its content, in hex
+func fileDigest(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify checks the files of the manifest at path: they must exist with the size and SHA-256 recorded.
+// The entries of the archives that are not encrypted are checked against the manifests of the archives,
+// and the content written for each message against its size and SHA-256, when they are recorded.
+// The path may also be an archive, checked against its own manifest. Verify returns the problems found,
+// none when the export is complete and unmodified.
+func Verify(path string) ([]string, error) {
+	if archiveCompression(path) != "" {
+		entries, err := verifyArchive(path)
+		if err != nil {
+			return nil, err
+		}
+		return entries.problems, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m TManifest
+	err = json.Unmarshal(b, &m)
+	if err != nil || m.Tool == "" {
+		return nil, fmt.Errorf("%s is not the manifest of an export", path)
+	}
+	var problems []string
+	if !m.Complete {
+		problems = append(problems, fmt.Sprintf("the export did not complete: %s", m.Error))
+	}
+	if len(m.Failed) > 0 {
+		problems = append(problems, fmt.Sprintf("%d messages were skipped on error", len(m.Failed)))
+	}
+	if !m.ByThread && len(m.Messages) != m.Exported {
+		problems = append(problems, fmt.Sprintf("%d messages exported but %d listed", m.Exported, len(m.Messages)))
+	}
+	dir := filepath.Dir(path)
+	archives := map[string]*tArchiveEntries{}
+	for _, f := range m.Files {
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		size, sum, err := fileDigest(p)
+		switch {
+		case os.IsNotExist(err):
+			problems = append(problems, fmt.Sprintf("%s: missing", f.Path))
+			continue
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Path, err))
+			continue
+		case size != f.Bytes:
+			problems = append(problems, fmt.Sprintf("%s: %d bytes instead of %d", f.Path, size, f.Bytes))
+		case sum != f.Sha256:
+			problems = append(problems, fmt.Sprintf("%s: modified, the SHA-256 differs", f.Path))
+		}
+		if archiveCompression(p) != "" {
+			entries, err := verifyArchive(p)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", f.Path, err))
+				continue
+			}
+			for _, problem := range entries.problems {
+				problems = append(problems, fmt.Sprintf("%s: %s", f.Path, problem))
+			}
+			archives[f.Path] = entries
+		}
+	}
+	listed := map[string]bool{"stdout": true}
+	for _, f := range m.Files {
+		listed[f.Path] = true
+	}
+	for _, message := range m.Messages {
+		if !listed[message.File] {
+			problems = append(problems, fmt.Sprintf("message %s: the file %s is not listed", message.Id, message.File))
+			listed[message.File] = true
+		}
+		if entries := archives[message.File]; entries != nil && message.Entry != "" && !entries.names[message.Entry] {
+			problems = append(problems, fmt.Sprintf("message %s: %s has no entry %s", message.Id, message.File, message.Entry))
+		}
+	}
+	return append(problems, verifyMessages(dir, m.Messages)...), nil
+}
+
+// verifyMessages checks the content written for the messages that have a SHA-256, in the files
+// and archive entries that can be read
+func verifyMessages(dir string, messages []TManifestMessage) []string {
+	var problems []string
+	byFile := map[string]map[string][]TManifestMessage{}
+	var files []string
+	for _, message := range messages {
+		if message.Sha256 == "" || message.File == "stdout" {
+			continue
+		}
+		if byFile[message.File] == nil {
+			byFile[message.File] = map[string][]TManifestMessage{}
+			files = append(files, message.File)
+		}
+		byFile[message.File][message.Entry] = append(byFile[message.File][message.Entry], message)
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		entries := byFile[file]
+		if archiveCompression(path) == "" {
+			content, err := openContent(path)
+			if err != nil {
+				// A missing file is reported with the files
+				continue
+			}
+			problems = append(problems, verifyBlocks(content, entries[""])...)
+			content.Close()
+			continue
+		}
+		err := readArchive(path, func(name string, r io.Reader) error {
+			problems = append(problems, verifyBlocks(r, entries[name])...)
+			delete(entries, name)
+			return nil
+		})
+		if err != nil {
+			// An archive that cannot be read is reported with the files
+			continue
+		}
+	}
+	return problems
+}
+
+// verifyBlocks checks the content written for the messages of a file or an archive entry against
+// their size and SHA-256, reading the content once
+func verifyBlocks(content io.Reader, messages []TManifestMessage) []string {
+	var problems []string
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Offset < messages[j].Offset })
+	var position int64
+	var last *TManifestMessage
+	var sum string
+	for i, message := range messages {
+		if last == nil || message.Offset != last.Offset || message.Bytes != last.Bytes {
+			sum = ""
+			_, err := io.CopyN(io.Discard, content, message.Offset-position)
+			if err == nil {
+				h := sha256.New()
+				_, err = io.CopyN(h, content, message.Bytes)
+				sum = hex.EncodeToString(h.Sum(nil))
+			}
+			position = message.Offset + message.Bytes
+			if err != nil {
+				sum = ""
+			}
+		}
+		last = &messages[i]
+		switch sum {
+		case "":
+			problems = append(problems, fmt.Sprintf("message %s: %s is shorter than recorded", message.Id, messageFile(message)))
+		case message.Sha256:
+		default:
+			problems = append(problems, fmt.Sprintf("message %s: modified in %s, the SHA-256 differs", message.Id, messageFile(message)))
+		}
+	}
+	return problems
+}
+
+// messageFile returns the file of the message, with its archive entry
+func messageFile(message TManifestMessage) string {
+	if message.Entry != "" {
+		return message.File + " entry " + message.Entry
+	}
+	return message.File
+}
+
+// openContent opens an output file, decompressing it if it has the extension of gzip or zstd
+func openContent(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(path, compressionExtension("gzip")):
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &tChainedReader{Reader: gz, file: file}, nil
+	case strings.HasSuffix(path, compressionExtension("zstd")):
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &tChainedReader{Reader: decoder.IOReadCloser(), file: file}, nil
+	default:
+		return file, nil
+	}
+}
+
+// tChainedReader closes the file after the reader of its content
+type tChainedReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *tChainedReader) Close() error {
+	if closer, ok := r.Reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return r.file.Close()
+}
+
+// contentSize returns the size of the content of an output file, after decompression
+func contentSize(path string) (int64, error) {
+	content, err := openContent(path)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close()
+	return io.Copy(io.Discard, content)
+}
+
+// archiveCompression returns the compression of the archive at path, "" if it is not an archive
+// or if it is encrypted
+func archiveCompression(path string) string {
+	for _, c := range compressionExtensions {
+		if strings.HasSuffix(path, c.extension) && isArchive(c.compress) {
+			return c.compress
+		}
+	}
+	return ""
+}
+
+// tArchiveEntries are the entries of an archive and the problems found checking them
+type tArchiveEntries struct {
+	names    map[string]bool
+	problems []string
+}
+
+// verifyArchive checks the entries of an archive against its manifest
+func verifyArchive(path string) (*tArchiveEntries, error) {
+	digests := map[string]TArchiveEntry{}
+	var order []string
+	var manifest *TArchiveManifest
+	err := readArchive(path, func(name string, r io.Reader) error {
+		if name == ManifestEntry {
+			manifest = &TArchiveManifest{}
+			return json.NewDecoder(r).Decode(manifest)
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+		digests[name] = TArchiveEntry{Name: name, Size: size, Sha256: hex.EncodeToString(h.Sum(nil))}
+		order = append(order, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := &tArchiveEntries{names: map[string]bool{}}
+	if manifest == nil {
+		entries.problems = append(entries.problems, fmt.Sprintf("no %s entry", ManifestEntry))
+		return entries, nil
+	}
+	for _, expected := range manifest.Entries {
+		entries.names[expected.Name] = true
+		found, ok := digests[expected.Name]
+		switch {
+		case !ok:
+			entries.problems = append(entries.problems, fmt.Sprintf("%s: missing", expected.Name))
+		case found.Size != expected.Size:
+			entries.problems = append(entries.problems, fmt.Sprintf("%s: %d bytes instead of %d", expected.Name, found.Size, expected.Size))
+		case found.Sha256 != expected.Sha256:
+			entries.problems = append(entries.problems, fmt.Sprintf("%s: modified, the SHA-256 differs", expected.Name))
+		}
+	}
+	for _, name := range order {
+		if !entries.names[name] {
+			entries.problems = append(entries.problems, fmt.Sprintf("%s: not in the manifest", name))
+		}
+	}
+	return entries, nil
+}
+
+// readArchive calls fn with the name and content of each entry of a zip, tar.gz or tar.zst archive
+func readArchive(path string, fn func(name string, r io.Reader) error) error {
+	compress := archiveCompression(path)
+	if compress == "zip" {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		for _, f := range archive.File {
+			r, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(f.Name, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader
+	if compress == "tar.gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		r = gz
+	} else {
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		r = decoder
+	}
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(header.Name, archive)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readManifest(t *testing.T, path string) TManifest {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var manifest TManifest
+	require.NoError(t, json.Unmarshal(b, &manifest))
+	return manifest
+}
+
+// Test the manifest lists the files and messages of a split export, and Verify finds the changes
+func TestExportManifest(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.json"), Split: true, Format: "json", Area: "small"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{Subject: "message"}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "gmail"+ManifestSuffix)
+	manifest := readManifest(t, path)
+	assert.Equal(t, "gmailexport", manifest.Tool)
+	assert.Equal(t, "me@example.com", manifest.Account)
+	assert.Equal(t, TFilter{Subject: "message"}.Query(), manifest.Query)
+	assert.Equal(t, int64(2), manifest.ResultSizeEstimate)
+	assert.Equal(t, 2, manifest.Found)
+	assert.Equal(t, 2, manifest.Exported)
+	assert.True(t, manifest.Complete)
+	require.Len(t, manifest.Files, 2)
+	assert.Equal(t, "gmail_0.json", manifest.Files[0].Path)
+	b, err := os.ReadFile(filepath.Join(dir, "gmail_0.json"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(b)), manifest.Files[0].Bytes)
+	require.Len(t, manifest.Messages, 2)
+	assert.Equal(t, TManifestMessage{Id: "2", ThreadId: manifest.Messages[0].ThreadId, File: "gmail_0.json", Bytes: int64(len(b)), Sha256: manifest.Files[0].Sha256}, manifest.Messages[0])
+
+	problems, err := Verify(path)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gmail_0.json"), append(b[:len(b)-1], ' '), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "gmail_1.json")))
+	problems, err = Verify(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gmail_0.json: modified, the SHA-256 differs", "gmail_1.json: missing",
+		"message 2: modified in gmail_0.json, the SHA-256 differs"}, problems)
+}
+
+// Test the messages of a single compressed file are recorded with the offsets of their blocks,
+// which Verify checks in the decompressed content
+func TestVerifyMessages(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.ndjson.gz"), Format: "ndjson", Area: "small"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "gmail"+ManifestSuffix)
+	manifest := readManifest(t, path)
+	require.Len(t, manifest.Messages, 2)
+	assert.Equal(t, int64(0), manifest.Messages[0].Offset)
+	assert.Equal(t, manifest.Messages[0].Bytes, manifest.Messages[1].Offset)
+	problems, err := Verify(path)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// The second message changed, and the digest of the file recorded again
+	content, err := openContent(filepath.Join(dir, "gmail.ndjson.gz"))
+	require.NoError(t, err)
+	b, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.NoError(t, content.Close())
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(bytes.Replace(b, []byte("Message 1"), []byte("Message X"), 1))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gmail.ndjson.gz"), buf.Bytes(), 0644))
+	manifest.Files[0].Bytes, manifest.Files[0].Sha256, err = fileDigest(filepath.Join(dir, "gmail.ndjson.gz"))
+	require.NoError(t, err)
+	b, err = json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0644))
+
+	problems, err = Verify(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"message 1: modified in gmail.ndjson.gz, the SHA-256 differs"}, problems)
+}
+
+// Test the messages of a format that writes its file as a whole have no digests
+func TestManifestRecords(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.parquet"), Format: "parquet", Area: "all"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	manifest := readManifest(t, filepath.Join(dir, "gmail"+ManifestSuffix))
+	require.Len(t, manifest.Messages, 2)
+	assert.Equal(t, TManifestMessage{Id: "2", ThreadId: manifest.Messages[0].ThreadId, File: "gmail.parquet"}, manifest.Messages[0])
+	problems, err := Verify(filepath.Join(dir, "gmail"+ManifestSuffix))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+// Test the manifest of an archive lists the archive and its entries, which Verify checks
+func TestVerifyArchive(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.tar.gz"), Format: "txt", Area: "small"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	manifest := readManifest(t, filepath.Join(dir, "gmail"+ManifestSuffix))
+	require.Len(t, manifest.Files, 1)
+	assert.Equal(t, "gmail.tar.gz", manifest.Files[0].Path)
+	assert.Equal(t, "gmail_1.txt", manifest.Messages[1].Entry)
+
+	problems, err := Verify(filepath.Join(dir, "gmail"+ManifestSuffix))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	problems, err = Verify(filepath.Join(dir, "gmail.tar.gz"))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+// Test an interrupted export writes an incomplete manifest
+func TestManifestIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	mailbox := newTestMailbox(t, 2)
+	mailbox.FailOn("GetMessage", "1", 1, assert.AnError)
+	statement := TStatement{Output: filepath.Join(dir, "gmail.ndjson"), Format: "ndjson", Area: "small"}
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, statement).Export(context.Background())
+	require.Error(t, err)
+
+	path := filepath.Join(dir, "gmail"+ManifestSuffix)
+	manifest := readManifest(t, path)
+	assert.False(t, manifest.Complete)
+	assert.Equal(t, 1, manifest.Exported)
+	problems, err := Verify(path)
+	require.NoError(t, err)
+	assert.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "the export did not complete")
+}
+
+// Test an existing manifest is not replaced: the export stops before writing anything
+func TestManifestExisting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gmail"+ManifestSuffix)
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+	statement := TStatement{Output: filepath.Join(dir, "gmail.json"), Format: "json", Area: "small"}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	assert.ErrorIs(t, err, os.ErrExist)
+	_, err = os.Stat(filepath.Join(dir, "gmail.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(b))
+}
+
+// Test the manifest of an encrypted export leaves out the digests of the plain text messages
+func TestManifestEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	statement := TStatement{Output: filepath.Join(dir, "gmail.json"), Split: true, Format: "json", Area: "small", EncryptTo: []string{identity.Recipient().String()}}
+
+	_, err = NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	manifest := readManifest(t, filepath.Join(dir, "gmail"+ManifestSuffix))
+	require.Len(t, manifest.Files, 2)
+	assert.NotEmpty(t, manifest.Files[0].Sha256)
+	assert.Equal(t, TManifestMessage{Id: "2", ThreadId: manifest.Messages[0].ThreadId, File: "gmail_0.json.age"}, manifest.Messages[0])
+}
+
+func TestManifestPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("out", "gmail"+ManifestSuffix), manifestPath(TStatement{Output: filepath.Join("out", "gmail.json.gz")}))
+	assert.Equal(t, "", manifestPath(TStatement{Output: "stdout"}))
+	assert.Equal(t, "audit.json", manifestPath(TStatement{Output: "stdout", Manifest: "audit.json"}))
+}
@@ -0,0 +1,187 @@
+package exporter
+
+import (
+	"fmt"
+	"gmailexport/app/areas"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"google.golang.org/api/gmail/v1"
+)
+
+// DefaultRowGroupSize is the number of messages of a parquet row group when the statement sets none
+const DefaultRowGroupSize = 10000
+
+// ParquetCompressions are the compression codecs of the parquet format
+var ParquetCompressions = map[string]compress.Codec{
+	"none":   &parquet.Uncompressed,
+	"snappy": &parquet.Snappy,
+	"gzip":   &parquet.Gzip,
+	"zstd":   &parquet.Zstd,
+	"lz4":    &parquet.Lz4Raw,
+}
+
+// TParquetMessage is a row of the parquet format. The schema is the same for every area:
+// the fields of the small and easy areas, with the labels and headers as lists.
+type TParquetMessage struct {
+	// Id: The immutable ID of the message.
+	Id string `parquet:"id" json:"id"`
+	// ThreadId: The ID of the thread the message belongs to.
+	ThreadId string `parquet:"threadId" json:"threadId"`
+	// InternalDate: The internal message creation timestamp.
+	InternalDate int64 `parquet:"internalDate,timestamp(millisecond)" json:"internalDate"`
+	// LabelIds: IDs of the labels applied to the message.
+	LabelIds []string `parquet:"labelIds,list" json:"labelIds"`
+	// LabelNames: Names of the labels applied to the message, nested labels as paths.
+	LabelNames []string `parquet:"labelNames,list" json:"labelNames"`
+	// SizeEstimate: Estimated size in bytes of the message.
+	SizeEstimate int64 `parquet:"sizeEstimate" json:"sizeEstimate"`
+	// Snippet: A short part of the message text.
+	Snippet string `parquet:"snippet" json:"snippet"`
+	// MessageId, Date, From, To, Subject: The headers of the small area.
+	MessageId string `parquet:"messageId" json:"messageId"`
+	Date      string `parquet:"date" json:"date"`
+	From      string `parquet:"from" json:"from"`
+	To        string `parquet:"to" json:"to"`
+	Subject   string `parquet:"subject" json:"subject"`
+	// Headers: All headers of the message, in order.
+	Headers []TParquetHeader `parquet:"headers,list" json:"headers"`
+	// PlainText: The plain text body of the message.
+	PlainText string `parquet:"plainText" json:"plainText"`
+}
+
+// TParquetHeader is a header of TParquetMessage
+type TParquetHeader struct {
+	Name  string `parquet:"name" json:"name"`
+	Value string `parquet:"value" json:"value"`
+}
+
+func init() {
+	registerFormat(tFormat{
+		name:        "parquet",
+		description: "a row per message with the same schema for every area, a row group at a time",
+		records: func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) (any, error) {
+			return toParquetRows(messages, annotations)
+		},
+		open: func(statement TStatement) (iOutput, error) {
+			return newParquetOutput(statement)
+		},
+	})
+}
+
+// newParquetMessage returns the row of the message
+func newParquetMessage(message *gmail.Message, annotations areas.TAnnotations) (TParquetMessage, error) {
+	small, err := areas.PrepareSmallArea(message, annotations)
+	if err != nil {
+		return TParquetMessage{}, err
+	}
+	easy, err := areas.PrepareEasyArea(message, annotations)
+	if err != nil {
+		return TParquetMessage{}, err
+	}
+	row := TParquetMessage{
+		Id:           small.Id,
+		ThreadId:     small.ThreadId,
+		InternalDate: small.InternalDate,
+		LabelIds:     small.LabelIds,
+		LabelNames:   small.LabelNames,
+		SizeEstimate: small.SizeEstimate,
+		Snippet:      small.Snippet,
+		MessageId:    small.MessageId,
+		Date:         small.Date,
+		From:         small.From,
+		To:           small.To,
+		Subject:      small.Subject,
+		Headers:      make([]TParquetHeader, len(easy.Headers)),
+		PlainText:    easy.PlainText,
+	}
+	for i, h := range easy.Headers {
+		row.Headers[i] = TParquetHeader{Name: h.Name, Value: h.Value}
+	}
+	return row, nil
+}
+
+// toParquetRows returns the rows of the messages
+func toParquetRows(messages []*gmail.Message, annotations []areas.TAnnotations) ([]TParquetMessage, error) {
+	rows := make([]TParquetMessage, 0, len(messages))
+	for i, message := range messages {
+		row, err := newParquetMessage(message, annotations[i])
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// tParquetOutput writes the rows to a parquet file or stdout. Rows are buffered up to the row group size,
+// so the memory used does not grow with the mailbox. The file is created with the first message.
+type tParquetOutput struct {
+	path    string
+	codec   *tCodec
+	options []parquet.WriterOption
+	file    io.WriteCloser
+	writer  *parquet.GenericWriter[TParquetMessage]
+}
+
+// newParquetOutput returns the parquet output defined by the statement
+func newParquetOutput(statement TStatement) (*tParquetOutput, error) {
+	if isArchive(statement.Compress) {
+		return nil, fmt.Errorf("the parquet format cannot be written into an archive")
+	}
+	if statement.Split {
+		return nil, fmt.Errorf("the parquet format cannot be split")
+	}
+	compression := statement.Compression
+	if compression == "" {
+		compression = "snappy"
+	}
+	parquetCodec, ok := ParquetCompressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown parquet compression %q", compression)
+	}
+	rowGroupSize := statement.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	return &tParquetOutput{
+		path:    statement.Output,
+		codec:   codec,
+		options: []parquet.WriterOption{parquet.Compression(parquetCodec), parquet.MaxRowsPerRowGroup(int64(rowGroupSize))},
+	}, nil
+}
+
+func (out *tParquetOutput) write(result TResult) (tLocation, error) {
+	location := tLocation{file: outputPath(out.path, out.codec)}
+	rows, ok := result.records.([]TParquetMessage)
+	if !ok {
+		return location, fmt.Errorf("the parquet output takes parquet rows, not %T", result.records)
+	}
+	if out.file == nil {
+		file, err := openOutput(out.path, false, out.codec)
+		if err != nil {
+			return location, err
+		}
+		out.file = file
+		out.writer = parquet.NewGenericWriter[TParquetMessage](file, out.options...)
+	}
+	_, err := out.writer.Write(rows)
+	return location, err
+}
+
+func (out *tParquetOutput) close() error {
+	if out.file == nil {
+		return nil
+	}
+	err := out.writer.Close()
+	if err != nil {
+		out.file.Close()
+		return err
+	}
+	return out.file.Close()
+}
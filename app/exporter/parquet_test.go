@@ -0,0 +1,45 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportParquet(t *testing.T) {
+	mailbox := newTestMailbox(t, 3)
+	path := filepath.Join(t.TempDir(), "out.parquet")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "parquet", Area: "all", RowGroupSize: 2, Compression: "zstd"}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.Exported)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	stat, err := file.Stat()
+	require.NoError(t, err)
+	pf, err := parquet.OpenFile(file, stat.Size())
+	require.NoError(t, err)
+	assert.Len(t, pf.RowGroups(), 2)
+	assert.Equal(t, "ZSTD", pf.Metadata().RowGroups[0].Columns[0].MetaData.Codec.String())
+
+	rows, err := parquet.Read[TParquetMessage](file, stat.Size())
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, "3", rows[0].Id)
+	assert.Equal(t, "Message 3", rows[0].Subject)
+	assert.Equal(t, []string{"INBOX"}, rows[0].LabelNames)
+	assert.Equal(t, TParquetHeader{Name: "From", Value: "sender3@example.com"}, rows[0].Headers[0])
+	assert.Equal(t, "Body 3\r\n", rows[0].PlainText)
+}
+
+func TestParquetCannotBeSplit(t *testing.T) {
+	_, err := newOutput(TStatement{Output: "out.parquet", Format: "parquet", Split: true})
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"gmailexport/app/areas"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"google.golang.org/api/gmail/v1"
+)
+
+func init() {
+	registerFormat(tFormat{
+		name:        "pdf",
+		description: "a readable PDF document with a bookmark per message",
+		records: func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) (any, error) {
+			return toReportRows(messages, annotations)
+		},
+		open: func(statement TStatement) (iOutput, error) {
+			return newPdfOutput(statement)
+		},
+	})
+}
+
+// tPdfDocument is a PDF document of messages, a page or more per message
+type tPdfDocument struct {
+	pdf        *fpdf.Fpdf
+	family     string
+	translate  func(string) string
+	exportedAt time.Time
+	// messageId is the Gmail ID printed in the footer of the current page
+	messageId string
+}
+
+// newPdfDocument returns an empty A4 document. Without a TrueType font the PDF core fonts are used,
+// which only have the characters of Windows-1252.
+func newPdfDocument(font []byte, exportedAt time.Time) *tPdfDocument {
+	d := &tPdfDocument{pdf: fpdf.New("P", "mm", "A4", ""), family: "Helvetica", exportedAt: exportedAt}
+	if font != nil {
+		d.family = "Body"
+		d.pdf.AddUTF8FontFromBytes(d.family, "", font)
+		d.pdf.AddUTF8FontFromBytes(d.family, "B", font)
+		d.translate = func(s string) string { return s }
+	} else {
+		d.translate = d.pdf.UnicodeTranslatorFromDescriptor("")
+	}
+	d.pdf.SetCreationDate(exportedAt)
+	d.pdf.SetModificationDate(exportedAt)
+	d.pdf.SetCreator("gmailexport", true)
+	d.pdf.SetAutoPageBreak(true, 20)
+	d.pdf.SetFooterFunc(func() {
+		d.pdf.SetY(-15)
+		d.pdf.SetFont(d.family, "", 8)
+		d.pdf.CellFormat(0, 5, d.translate(fmt.Sprintf("Gmail ID %s · exported %s · page %d",
+			d.messageId, d.exportedAt.UTC().Format(time.RFC3339), d.pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	return d
+}
+
+// add renders the message from a new page, with a bookmark to its subject
+func (d *tPdfDocument) add(m TReportMessage) {
+	pdf := d.pdf
+	pdf.AddPage()
+	// The footer of the previous page is written by AddPage
+	d.messageId = m.Id
+	subject := m.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	pdf.Bookmark(d.translate(subject), 0, -1)
+
+	pdf.SetFont(d.family, "B", 14)
+	pdf.MultiCell(0, 7, d.translate(subject), "", "L", false)
+	pdf.Ln(2)
+	for _, field := range [][2]string{
+		{"From", m.From},
+		{"To", strings.Join(m.To, ", ")},
+		{"Cc", strings.Join(m.Cc, ", ")},
+		{"Date", m.Date.UTC().Format("2006-01-02 15:04 UTC")},
+		{"Labels", strings.Join(m.Labels, ", ")},
+		{"Gmail ID", m.Id},
+	} {
+		if field[1] == "" {
+			continue
+		}
+		pdf.SetFont(d.family, "B", 10)
+		pdf.CellFormat(22, 5, d.translate(field[0]+":"), "", 0, "L", false, 0, "")
+		pdf.SetFont(d.family, "", 10)
+		pdf.MultiCell(0, 5, d.translate(field[1]), "", "L", false)
+	}
+	pdf.Ln(2)
+	y := pdf.GetY()
+	pdf.Line(10, y, 200, y)
+	pdf.Ln(4)
+
+	pdf.SetFont(d.family, "", 10)
+	pdf.MultiCell(0, 5, d.translate(strings.ReplaceAll(strings.TrimSpace(m.Body), "\r\n", "\n")), "", "L", false)
+
+	if len(m.Attachments) > 0 {
+		pdf.Ln(4)
+		pdf.SetFont(d.family, "B", 10)
+		pdf.MultiCell(0, 5, d.translate("Attachments"), "", "L", false)
+		pdf.SetFont(d.family, "", 10)
+		for _, a := range m.Attachments {
+			pdf.MultiCell(0, 5, d.translate(fmt.Sprintf("- %s (%s, %s)", a.Filename, a.MimeType, formatSize(a.Size))), "", "L", false)
+		}
+	}
+}
+
+// bytes returns the rendered document
+func (d *tPdfDocument) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	err := d.pdf.Output(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tPdfOutput renders the messages into one PDF document with a bookmark per message, written when
+// the output is closed, or with Split into a document per message (per thread when exporting by thread)
+type tPdfOutput struct {
+	path       string
+	codec      *tCodec
+	font       []byte
+	exportedAt time.Time
+	split      *tSplitOutput
+	document   *tPdfDocument
+}
+
+// newPdfOutput returns the pdf output defined by the statement
+func newPdfOutput(statement TStatement) (*tPdfOutput, error) {
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	out := &tPdfOutput{path: statement.Output, codec: codec, exportedAt: time.Now()}
+	if statement.PdfFont != "" {
+		font, err := os.ReadFile(statement.PdfFont)
+		if err != nil {
+			return nil, err
+		}
+		out.font = font
+	}
+	if statement.Split {
+		out.split, err = newSplitOutput(statement, ".pdf", "", "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (out *tPdfOutput) write(result TResult) (tLocation, error) {
+	location := tLocation{file: outputPath(out.path, out.codec)}
+	messages, err := reportMessages(result)
+	if err != nil {
+		return location, err
+	}
+	document := out.document
+	if document == nil || out.split != nil {
+		document = newPdfDocument(out.font, out.exportedAt)
+		document.pdf.SetTitle(document.translate("Gmail export"), out.font != nil)
+	}
+	for _, m := range messages {
+		document.add(m)
+	}
+	if err := document.pdf.Error(); err != nil {
+		return location, err
+	}
+	if out.split == nil {
+		out.document = document
+		return location, nil
+	}
+	b, err := document.bytes()
+	if err != nil {
+		return location, err
+	}
+	return out.split.write(TResult{Block: b})
+}
+
+func (out *tPdfOutput) close() error {
+	if out.split != nil {
+		return out.split.close()
+	}
+	if out.document == nil {
+		return nil
+	}
+	b, err := out.document.bytes()
+	if err != nil {
+		return err
+	}
+	file, err := openOutput(out.path, false, out.codec)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(b)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
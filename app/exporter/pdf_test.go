@@ -0,0 +1,71 @@
+package exporter
+
+import (
+	"context"
+	"gmailexport/app/areas"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Test the combined document has a bookmark per message
+func TestExportPdf(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "messages.pdf")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "pdf", Area: "all"}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "%PDF-"))
+	assert.Contains(t, string(b), "/Title (Other)")
+	assert.Contains(t, string(b), "/Title (Re: Plan)")
+	assert.Contains(t, string(b), "/Title (Plan)")
+	assert.Contains(t, string(b), "/Count 3")
+}
+
+func TestExportPdfSplit(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	dir := t.TempDir()
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: filepath.Join(dir, "message.pdf"), Split: true, Format: "pdf", Area: "all"}).Export(context.Background())
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	// A document per message and the manifest
+	assert.Len(t, entries, 4)
+}
+
+// Test the footer shows the Gmail ID of the message on each of its pages
+func TestPdfDocumentFooter(t *testing.T) {
+	exportedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	document := newPdfDocument(nil, exportedAt)
+	document.pdf.SetCompression(false)
+	document.add(TReportMessage{Id: "first", Subject: "Long", Body: strings.Repeat("line\n", 80)})
+	document.add(TReportMessage{Id: "second", Subject: "Short", Body: "Bye", Attachments: []TReportAttachment{{Filename: "a.pdf", MimeType: "application/pdf", Size: 2048}}})
+	b, err := document.bytes()
+	require.NoError(t, err)
+
+	pdf := string(b)
+	assert.Equal(t, 2, strings.Count(pdf, "(Gmail ID first \xb7 exported 2026-10-19T12:00:00Z \xb7 page"))
+	assert.Equal(t, 1, strings.Count(pdf, "(Gmail ID second \xb7 exported 2026-10-19T12:00:00Z \xb7 page 3)"))
+	assert.Contains(t, pdf, "(- a.pdf \\(application/pdf, 2.0 KB\\))")
+}
+
+// Test an HTML-only message is rendered as text
+func TestReportMessageHtmlBody(t *testing.T) {
+	message := &gmail.Message{Id: "1", Payload: &gmail.MessagePart{MimeType: "text/html", Body: &gmail.MessagePartBody{
+		Data: "PGh0bWw-PGhlYWQ-PHN0eWxlPnB7fTwvc3R5bGU-PC9oZWFkPjxib2R5PjxwPkhlbGxvICZhbXA7PGJyPndlbGNvbWU8L3A-PHNjcmlwdD54KCk8L3NjcmlwdD48cD5CeWU8L3A-PC9ib2R5PjwvaHRtbD4=",
+	}}}
+	m, err := newReportMessage(message, areas.TAnnotations{})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello &\nwelcome\n\nBye", m.Body)
+}
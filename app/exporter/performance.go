@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"fmt"
+	"gmailexport/app/areas"
+	"gmailexport/app/redact"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// performance processes a message according to the given statement
+// and returns the result with the prepared message, redacted if there is a redactor, and its formatted
+// output, rendered with the user template if there is one
+func performance(message *gmail.Message, annotations areas.TAnnotations, statement TStatement, template *tTemplate, redactor *redact.TRedactor) (TResult, error) {
+	result := TResult{Message: message}
+	preparedMessage, err := prepareMessage(message, annotations, statement.Area)
+	if err != nil {
+		return result, err
+	}
+	preparedMessage, err = redactMessage(preparedMessage, redactor)
+	if err != nil {
+		return result, err
+	}
+	result.Area = preparedMessage
+	switch {
+	case template != nil:
+		result.Block, err = template.render(preparedMessage)
+	case isRows(statement.Format):
+		messages := redactGmailMessages([]*gmail.Message{message}, redactor)
+		result.Block, result.records, err = toRows(messages, []areas.TAnnotations{annotations}, statement)
+	default:
+		result.Block, err = toFormat(preparedMessage, statement.Format)
+	}
+	return result, err
+}
+
+// rowsArea is the only area of the formats that write rows or records: they convert the Gmail
+// messages themselves, so a smaller or custom area would not change what they write
+const rowsArea = "all"
+
+// checkArea returns an error if the statement selects an area that its format ignores
+func checkArea(statement TStatement) error {
+	if statement.Template == "" && isRows(statement.Format) && statement.Area != rowsArea {
+		return fmt.Errorf("the %s format writes the same fields for every area, it cannot export the %s area", statement.Format, statement.Area)
+	}
+	return nil
+}
+
+// isRows reports whether the format writes the messages as rows or records, independently of the area
+func isRows(format string) bool {
+	f, err := lookupFormat(format)
+	return err == nil && (f.rows != nil || f.records != nil)
+}
+
+// toRows converts messages to a block of rows of the format, e.g. csv rows without the header,
+// or to the records of the parquet, sqlite, markdown, html and pdf formats
+func toRows(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) ([]byte, any, error) {
+	format, err := lookupFormat(statement.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case format.records != nil:
+		records, err := format.records(messages, annotations, statement)
+		return nil, records, err
+	case format.rows != nil:
+		block, err := format.rows(messages, annotations, statement)
+		return block, nil, err
+	}
+	return nil, nil, fmt.Errorf("the %s format does not write rows", format.name)
+}
+
+// prepareMessage prepares a Gmail message according to the registered area
+func prepareMessage(message *gmail.Message, annotations areas.TAnnotations, area string) (any, error) {
+	a, ok := areas.Lookup(area)
+	if !ok {
+		return nil, fmt.Errorf("unknown area %q", area)
+	}
+	return a.Prepare(message, annotations)
+}
+
+// toFormat converts a prepared message, thread or label to a block of the format
+func toFormat(v any, format string) ([]byte, error) {
+	f, err := lookupFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if f.encode == nil {
+		return nil, fmt.Errorf("the %s format does not write prepared messages", f.name)
+	}
+	return f.encode(v)
+}
@@ -0,0 +1,166 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TProgress is the state of an export, passed to the function of SetProgress at every change.
+// When exporting by thread the counters count threads.
+type TProgress struct {
+	// Unit: "messages" or "threads".
+	Unit string
+	// Started: when the export started.
+	Started time.Time
+	// Listing: the IDs are being listed, Listed of them so far.
+	Listing bool
+	Listed  int
+	// ResultSizeEstimate: Gmail's estimate of the number of messages, known after the first page.
+	ResultSizeEstimate int64
+	// Found: the number of IDs listed, known when the listing is over.
+	Found int
+	// Fetched, Formatted and Written: the messages fetched from Gmail, prepared and formatted,
+	// and written to the output (or passed to the callback of Each).
+	Fetched   int
+	Formatted int
+	Written   int
+	// Duplicates: the messages skipped because they were exported before.
+	Duplicates int
+	// Failed: the messages skipped on error with the OnError policy "skip" or "retry".
+	Failed int
+	// Bytes: the size of the blocks written.
+	Bytes int64
+}
+
+// Total returns the number of messages to export: Found, or the estimate while listing
+func (p TProgress) Total() int {
+	if p.Listing {
+		return int(p.ResultSizeEstimate)
+	}
+	return p.Found
+}
+
+// Processed returns the number of messages written or skipped as duplicates or on error
+func (p TProgress) Processed() int {
+	return p.Written + p.Duplicates + p.Failed
+}
+
+// Rate returns the messages written per second since the start
+func (p TProgress) Rate(now time.Time) float64 {
+	elapsed := now.Sub(p.Started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Written) / elapsed
+}
+
+// ETA returns the estimated time until all found messages are processed, at the rate so far;
+// 0 while listing or before the first message
+func (p TProgress) ETA(now time.Time) time.Duration {
+	processed := p.Processed()
+	if p.Listing || processed == 0 || p.Found <= processed {
+		return 0
+	}
+	elapsed := now.Sub(p.Started)
+	return time.Duration(float64(elapsed) / float64(processed) * float64(p.Found-processed)).Round(time.Second)
+}
+
+// Status returns the progress as a line of text
+func (p TProgress) Status(now time.Time) string {
+	if p.Listing {
+		status := fmt.Sprintf("listing %s: %d", p.Unit, p.Listed)
+		if p.ResultSizeEstimate > 0 {
+			status += fmt.Sprintf(" of about %d", p.ResultSizeEstimate)
+		}
+		return status
+	}
+	parts := []string{fmt.Sprintf("%d/%d %s", p.Processed(), p.Found, p.Unit)}
+	if p.Found > 0 {
+		parts[0] += fmt.Sprintf(" (%d%%)", p.Processed()*100/p.Found)
+	}
+	parts = append(parts,
+		fmt.Sprintf("fetched %d, formatted %d, written %d", p.Fetched, p.Formatted, p.Written),
+		fmt.Sprintf("%.1f/s", p.Rate(now)),
+		formatSize(p.Bytes))
+	if p.Duplicates > 0 {
+		parts = append(parts, fmt.Sprintf("%d duplicates", p.Duplicates))
+	}
+	if p.Failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", p.Failed))
+	}
+	if eta := p.ETA(now); eta > 0 {
+		parts = append(parts, "ETA "+eta.String())
+	}
+	return strings.Join(parts, " | ")
+}
+
+// tProgress keeps the progress of an export and reports every change. Its methods do nothing on
+// a nil tProgress, the progress of an export without SetProgress.
+type tProgress struct {
+	state  TProgress
+	report func(TProgress)
+}
+
+// SetProgress makes the export call report with its progress at every change: a page of IDs listed,
+// a message fetched, formatted or written. report is called in the goroutine of the export,
+// so it should be quick; to display the progress, keep the last state and show it at intervals.
+func (e *Exporter) SetProgress(report func(TProgress)) {
+	e.progress = &tProgress{report: report}
+}
+
+func (p *tProgress) update(change func(state *TProgress)) {
+	if p == nil {
+		return
+	}
+	change(&p.state)
+	p.report(p.state)
+}
+
+// start starts the listing
+func (p *tProgress) start(unit string) {
+	p.update(func(state *TProgress) {
+		*state = TProgress{Unit: unit, Started: time.Now(), Listing: true}
+	})
+}
+
+// listed counts the IDs of a page and records the estimate of the first one
+func (p *tProgress) listed(n int, estimate int64) {
+	p.update(func(state *TProgress) {
+		state.Listed += n
+		if state.ResultSizeEstimate == 0 {
+			state.ResultSizeEstimate = estimate
+		}
+	})
+}
+
+// found ends the listing
+func (p *tProgress) found(n int) {
+	p.update(func(state *TProgress) {
+		state.Listing = false
+		state.Found = n
+	})
+}
+
+func (p *tProgress) fetched() {
+	p.update(func(state *TProgress) { state.Fetched++ })
+}
+
+func (p *tProgress) formatted() {
+	p.update(func(state *TProgress) { state.Formatted++ })
+}
+
+func (p *tProgress) written(block []byte) {
+	p.update(func(state *TProgress) {
+		state.Written++
+		state.Bytes += int64(len(block))
+	})
+}
+
+func (p *tProgress) duplicate() {
+	p.update(func(state *TProgress) { state.Duplicates++ })
+}
+
+func (p *tProgress) failed() {
+	p.update(func(state *TProgress) { state.Failed++ })
+}
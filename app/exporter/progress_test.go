@@ -0,0 +1,47 @@
+package exporter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the export reports the listing, then every message fetched, formatted and written
+func TestExportProgress(t *testing.T) {
+	dir := t.TempDir()
+	statement := TStatement{Output: filepath.Join(dir, "gmail.json"), Format: "json", Area: "small"}
+	e := NewWithClient(newTestMailbox(t, 3), "me", TFilter{}, statement)
+	var states []TProgress
+	e.SetProgress(func(p TProgress) { states = append(states, p) })
+
+	_, err := e.Export(context.Background())
+	require.NoError(t, err)
+
+	require.NotEmpty(t, states)
+	assert.True(t, states[0].Listing)
+	last := states[len(states)-1]
+	assert.False(t, last.Listing)
+	assert.Equal(t, "messages", last.Unit)
+	assert.Equal(t, int64(3), last.ResultSizeEstimate)
+	assert.Equal(t, 3, last.Found)
+	assert.Equal(t, 3, last.Fetched)
+	assert.Equal(t, 3, last.Formatted)
+	assert.Equal(t, 3, last.Written)
+	assert.Positive(t, last.Bytes)
+}
+
+func TestProgressStatus(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	p := TProgress{Unit: "messages", Started: start, Listing: true, Listed: 200, ResultSizeEstimate: 1000}
+	assert.Equal(t, "listing messages: 200 of about 1000", p.Status(start.Add(time.Second)))
+	assert.Equal(t, 1000, p.Total())
+
+	p = TProgress{Unit: "messages", Started: start, Found: 1000, Fetched: 252, Formatted: 251, Written: 250, Bytes: 3 << 20}
+	now := start.Add(100 * time.Second)
+	assert.Equal(t, 5*time.Minute, p.ETA(now))
+	assert.Equal(t, "250/1000 messages (25%) | fetched 252, formatted 251, written 250 | 2.5/s | 3.0 MB | ETA 5m0s", p.Status(now))
+}
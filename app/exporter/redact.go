@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	"encoding/base64"
+	"fmt"
+	"gmailexport/app/areas"
+	"gmailexport/app/redact"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// newRedactor returns the redactor of the statement, nil without redaction
+func newRedactor(statement TStatement) (*redact.TRedactor, error) {
+	if statement.Redact == nil {
+		return nil, nil
+	}
+	return redact.New(*statement.Redact)
+}
+
+// redactMessage returns the prepared message redacted, or as it is without a redactor
+func redactMessage(prepared any, redactor *redact.TRedactor) (any, error) {
+	if redactor == nil {
+		return prepared, nil
+	}
+	r, ok := prepared.(areas.IRedactable)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot be redacted", prepared)
+	}
+	return r.Redact(redactor.Session()), nil
+}
+
+// redactGmailMessages returns copies of the Gmail messages redacted for the formats that write rows or
+// records, which are made from the Gmail messages rather than from the prepared ones.
+// Without a redactor the messages are returned as they are.
+func redactGmailMessages(messages []*gmail.Message, redactor *redact.TRedactor) []*gmail.Message {
+	if redactor == nil {
+		return messages
+	}
+	redacted := make([]*gmail.Message, len(messages))
+	for i, message := range messages {
+		s := redactor.Session()
+		m := *message
+		m.Snippet = s.Text(m.Snippet)
+		m.Payload = redactPart(s, m.Payload)
+		if m.Raw != "" {
+			raw, err := base64.URLEncoding.DecodeString(m.Raw)
+			if err == nil {
+				m.Raw = base64.URLEncoding.EncodeToString([]byte(s.Raw(string(raw))))
+			} else {
+				// A raw message that cannot be read cannot be redacted either
+				m.Raw = ""
+			}
+		}
+		redacted[i] = &m
+	}
+	return redacted
+}
+
+// redactPart returns a copy of the MIME part with its headers redacted, and the bodies of its text parts
+// redacted like texts; other bodies, such as attachments, are left as they are
+func redactPart(s *redact.TSession, part *gmail.MessagePart) *gmail.MessagePart {
+	if part == nil {
+		return nil
+	}
+	p := *part
+	p.Headers = nil
+	for _, h := range part.Headers {
+		value, keep := s.Header(h.Name, h.Value)
+		if keep {
+			p.Headers = append(p.Headers, &gmail.MessagePartHeader{Name: h.Name, Value: value})
+		}
+	}
+	if strings.HasPrefix(p.MimeType, "text/") && p.Body != nil && p.Body.Data != "" {
+		body := *p.Body
+		text, err := base64.URLEncoding.DecodeString(body.Data)
+		if err == nil {
+			redacted := s.Text(string(text))
+			body.Data = base64.URLEncoding.EncodeToString([]byte(redacted))
+			body.Size = int64(len(redacted))
+		}
+		p.Body = &body
+	}
+	p.Parts = make([]*gmail.MessagePart, len(part.Parts))
+	for i, child := range part.Parts {
+		p.Parts[i] = redactPart(s, child)
+	}
+	return &p
+}
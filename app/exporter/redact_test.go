@@ -0,0 +1,57 @@
+package exporter
+
+import (
+	"context"
+	"gmailexport/app/gmailapi/fake"
+	"gmailexport/app/redact"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	config := redact.TConfig{MaskEmails: true, HashHeaders: []string{"Message-ID"}}
+
+	_, err := NewWithClient(newTestMailbox(t, 1), "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small", Redact: &config}).Export(context.Background())
+	require.NoError(t, err)
+	messages := readJson(t, path)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "***@example.com", messages[0]["from"])
+	assert.Equal(t, "***@example.com", messages[0]["to"])
+	assert.Regexp(t, "^sha256:", messages[0]["messageId"])
+	assert.Equal(t, "Message 1", messages[0]["subject"])
+	assert.Equal(t, []interface{}{"email", "hash:Message-ID"}, messages[0]["redactions"])
+}
+
+func TestExportRedactedRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	config := redact.DefaultConfig
+
+	_, err := NewWithClient(newTestMailbox(t, 1), "me", TFilter{}, TStatement{Output: path, Format: "csv", Area: "all",
+		Columns: []string{"from", "to", "subject"}, Redact: &config}).Export(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "from,to,subject\r\n***@example.com,***@example.com,Message 1\r\n", string(b))
+}
+
+// Test the body of a report is redacted like the texts of the prepared messages
+func TestExportRedactedReport(t *testing.T) {
+	mailbox := fake.New()
+	message, err := fake.ParseMessage([]byte("From: alice@example.com\r\nSubject: Call\r\n\r\nCall me at +1 555 123 4567 or write to alice@example.com.\r\n"))
+	require.NoError(t, err)
+	mailbox.AddMessage(message)
+	path := filepath.Join(t.TempDir(), "out.md")
+	config := redact.DefaultConfig
+
+	_, err = NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "markdown", Area: "all", Redact: &config}).Export(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "Call me at [phone] or write to ***@example.com.")
+	assert.NotContains(t, string(b), "alice@")
+}
@@ -0,0 +1,363 @@
+package exporter
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"gmailexport/app/areas"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/html"
+	"google.golang.org/api/gmail/v1"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// reportDocument renders a report with the templates "header", "message" and "footer"
+const reportDocument = `{{template "header" .}}{{range .Messages}}{{template "message" .}}{{end}}{{template "footer" .}}`
+
+// TReport is the data of the markdown and html templates
+type TReport struct {
+	// Title: The title of the document.
+	Title string
+	// Messages: The messages of the document, in the order of the export.
+	Messages []TReportMessage
+}
+
+// TReportMessage is a message of TReport
+type TReportMessage struct {
+	// Index: The number of the message in the document, from 1.
+	Index int `json:"index"`
+	// Anchor: The ID of the message section, for links from the table of contents.
+	Anchor      string              `json:"anchor"`
+	Id          string              `json:"id"`
+	ThreadId    string              `json:"threadId"`
+	Date        time.Time           `json:"date"`
+	From        string              `json:"from"`
+	To          []string            `json:"to"`
+	Cc          []string            `json:"cc"`
+	Subject     string              `json:"subject"`
+	Labels      []string            `json:"labels"`
+	Body        string              `json:"body"`
+	Attachments []TReportAttachment `json:"attachments"`
+}
+
+// TReportAttachment is an attached file of TReportMessage
+type TReportAttachment struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+// iTemplate is a text or html template
+type iTemplate interface {
+	ExecuteTemplate(w io.Writer, name string, data any) error
+}
+
+func init() {
+	for _, f := range []struct{ name, extension, description string }{
+		{"markdown", ".md", "a readable markdown report with a table of contents"},
+		{"html", ".html", "a readable html report with a table of contents"},
+	} {
+		registerFormat(tFormat{
+			name:        f.name,
+			description: f.description,
+			extension:   f.extension,
+			records: func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) (any, error) {
+				return toReportRows(messages, annotations)
+			},
+			open: func(statement TStatement) (iOutput, error) {
+				return newReportOutput(statement)
+			},
+		})
+	}
+}
+
+// reportFuncs are the functions available in the report templates
+var reportFuncs = map[string]any{
+	"join": strings.Join,
+	"trim": strings.TrimSpace,
+	"date": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04 UTC")
+	},
+	"size": formatSize,
+	"md":   escapeMarkdown,
+	"fence": func(text string) string {
+		return strings.Repeat("`", max(3, longestRun(text, '`')+1))
+	},
+}
+
+// newReportTemplate returns the embedded template of the markdown or html format
+func newReportTemplate(format string) (iTemplate, error) {
+	switch format {
+	case "markdown":
+		t := template.New("document").Funcs(reportFuncs)
+		t, err := t.ParseFS(templates, "templates/report.md.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		return t.Parse(reportDocument)
+	case "html":
+		t := htmltemplate.New("document").Funcs(reportFuncs)
+		t, err := t.ParseFS(templates, "templates/report.html.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		return t.Parse(reportDocument)
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// newReportMessage returns the report data of the message
+func newReportMessage(message *gmail.Message, annotations areas.TAnnotations) (TReportMessage, error) {
+	easy, err := areas.PrepareEasyArea(message, annotations)
+	if err != nil {
+		return TReportMessage{}, err
+	}
+	m := TReportMessage{
+		Id:       message.Id,
+		ThreadId: message.ThreadId,
+		Date:     time.UnixMilli(message.InternalDate).UTC(),
+		From:     formatAddresses(messageHeader(message, "From"), ", "),
+		To:       splitAddresses(messageHeader(message, "To")),
+		Cc:       splitAddresses(messageHeader(message, "Cc")),
+		Subject:  messageHeader(message, "Subject"),
+		Labels:   annotations.LabelNames,
+		Body:     easy.PlainText,
+	}
+	if m.Body == "" {
+		m.Body = htmlText(htmlBody(message.Payload))
+	}
+	if m.Body == "" {
+		m.Body = message.Snippet
+	}
+	for _, a := range sqliteAttachments(message.Payload, nil) {
+		m.Attachments = append(m.Attachments, TReportAttachment{Filename: a.Filename, MimeType: a.MimeType, Size: a.Size})
+	}
+	return m, nil
+}
+
+// htmlBody returns the decoded first text/html part of the message
+func htmlBody(part *gmail.MessagePart) string {
+	if part == nil {
+		return ""
+	}
+	if part.MimeType == "text/html" && part.Body != nil {
+		b, err := base64.URLEncoding.DecodeString(part.Body.Data)
+		if err == nil {
+			return string(b)
+		}
+	}
+	for _, p := range part.Parts {
+		if body := htmlBody(p); body != "" {
+			return body
+		}
+	}
+	return ""
+}
+
+// htmlText returns the text of an HTML document: scripts, styles and tags are dropped,
+// and block elements start new lines
+func htmlText(document string) string {
+	var b strings.Builder
+	skip := 0
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			var lines []string
+			for _, line := range strings.Split(b.String(), "\n") {
+				line = strings.Join(strings.Fields(line), " ")
+				// At most one empty line between paragraphs
+				if line != "" || (len(lines) > 0 && lines[len(lines)-1] != "") {
+					lines = append(lines, line)
+				}
+			}
+			return strings.TrimSpace(strings.Join(lines, "\n"))
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				skip++
+			case "br", "p", "div", "tr", "li", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				b.WriteString("\n")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				skip = max(0, skip-1)
+			case "p", "div", "tr", "li", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				b.WriteString("\n")
+			}
+		}
+	}
+}
+
+// splitAddresses returns the addresses of an address list header as formatAddresses writes them
+func splitAddresses(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(formatAddresses(value, "\n"), "\n")
+}
+
+// toReportRows returns the report data of the messages
+func toReportRows(messages []*gmail.Message, annotations []areas.TAnnotations) ([]TReportMessage, error) {
+	rows := make([]TReportMessage, 0, len(messages))
+	for i, message := range messages {
+		m, err := newReportMessage(message, annotations[i])
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, m)
+	}
+	return rows, nil
+}
+
+// reportMessages returns the report data of the result
+func reportMessages(result TResult) ([]TReportMessage, error) {
+	messages, ok := result.records.([]TReportMessage)
+	if !ok {
+		return nil, fmt.Errorf("the report outputs take report messages, not %T", result.records)
+	}
+	return messages, nil
+}
+
+// tReportOutput renders the messages with the templates of the format. The single output keeps
+// the messages until it is closed, because the table of contents comes first; the split output
+// renders a document per message, or per thread when exporting by thread.
+type tReportOutput struct {
+	path     string
+	codec    *tCodec
+	template iTemplate
+	split    *tSplitOutput
+	messages []TReportMessage
+}
+
+// newReportOutput returns the markdown or html output defined by the statement
+func newReportOutput(statement TStatement) (*tReportOutput, error) {
+	t, err := newReportTemplate(statement.Format)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	out := &tReportOutput{path: statement.Output, codec: codec, template: t}
+	if statement.Split {
+		out.split, err = newSplitOutput(statement, formats[statement.Format].extension, "", "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (out *tReportOutput) write(result TResult) (tLocation, error) {
+	location := tLocation{file: outputPath(out.path, out.codec)}
+	messages, err := reportMessages(result)
+	if err != nil {
+		return location, err
+	}
+	if out.split == nil {
+		out.messages = append(out.messages, messages...)
+		return location, nil
+	}
+	document, err := out.render(messages)
+	if err != nil {
+		return location, err
+	}
+	return out.split.write(TResult{Block: document})
+}
+
+// render returns the document of the messages
+func (out *tReportOutput) render(messages []TReportMessage) ([]byte, error) {
+	report := TReport{Title: "Gmail export", Messages: messages}
+	for i := range report.Messages {
+		report.Messages[i].Index = i + 1
+		report.Messages[i].Anchor = fmt.Sprintf("message-%d", i+1)
+	}
+	if len(messages) == 1 {
+		report.Title = messages[0].Subject
+	}
+	var buf bytes.Buffer
+	err := out.template.ExecuteTemplate(&buf, "document", report)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (out *tReportOutput) close() error {
+	if out.split != nil {
+		return out.split.close()
+	}
+	if len(out.messages) == 0 {
+		return nil
+	}
+	document, err := out.render(out.messages)
+	if err != nil {
+		return err
+	}
+	file, err := openOutput(out.path, false, out.codec)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(document)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// formatSize returns the size in bytes in a human-readable unit
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// escapeMarkdown escapes the characters of the text that markdown would interpret
+func escapeMarkdown(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\`*_[]<>#|", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// longestRun returns the length of the longest run of the rune in the text
+func longestRun(text string, r rune) int {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c != r {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return longest
+}
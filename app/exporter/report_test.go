@@ -0,0 +1,47 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportMarkdown(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "report.md")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "markdown", Area: "all"}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	report := string(b)
+	assert.Contains(t, report, "# Gmail export\n\n3 messages\n\n1. [Other](#message-1) — dave@example.com, 2021-05-05 10:00 UTC\n")
+	assert.Contains(t, report, "<a id=\"message-3\"></a>\n## 3. Plan\n")
+	assert.Contains(t, report, "| **From** | Bob \\<bob@example.com\\> |\n| **To** | alice@example.com |\n| **Cc** | Carol \\<carol@example.com\\> |\n")
+	assert.Contains(t, report, "```text\nSure.\n```\n")
+}
+
+func TestExportHtmlSplit(t *testing.T) {
+	mailbox := newTestMailbox(t, 0)
+	mailbox.AddMessage(attachmentMessage(t, "Invoice <May>"))
+	dir := t.TempDir()
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: filepath.Join(dir, "message.html"), Split: true, Format: "html", Area: "all"}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "message_0.html"))
+	require.NoError(t, err)
+	report := string(b)
+	assert.Contains(t, report, "<title>Invoice &lt;May&gt;</title>")
+	assert.Contains(t, report, "<section id=\"message-1\">\n<h2>1. Invoice &lt;May&gt;</h2>")
+	assert.Contains(t, report, "<li>invoice.pdf (application/pdf, 3 B)</li>")
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	assert.Equal(t, "\\[a\\]\\*b\\* \\| c\\_d", escapeMarkdown("[a]*b* | c_d"))
+}
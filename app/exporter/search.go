@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"context"
+	"gmailexport/app/gmailapi"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// tListMessages represents a collection of Gmail messages and the estimated total number of results.
+type tListMessages struct {
+	messages           []*gmail.Message
+	resultSizeEstimate int64
+}
+
+// newListMessages initializes a new instance of tListMessages with default values.
+func newListMessages() *tListMessages {
+	return &tListMessages{
+		messages:           make([]*gmail.Message, 0),
+		resultSizeEstimate: 0,
+	}
+}
+
+// addList adds a list of messages and updates the result size estimate.
+// listMsg: List of messages to add.
+// size: The number to add to the result size estimate.
+func (listMessages *tListMessages) addList(listMsg []*gmail.Message, size int64) {
+	listMessages.messages = append(listMessages.messages, listMsg...)
+	listMessages.resultSizeEstimate += size
+}
+
+// search retrieves the IDs of messages from a user's Gmail account based on the provided filter.
+// client: The Gmail API client used to make API calls.
+// user: The email address (or me) of the user whose messages should be retrieved.
+// filter: The filter criteria used to search for messages.
+// progress: Counts the IDs of each page.
+// Returns a tListMessages containing the found messages (IDs only) and an error, if any.
+// On error the messages found so far are returned too.
+func search(ctx context.Context, client gmailapi.IClient, user string, filter TFilter, progress *tProgress) (*tListMessages, error) {
+	listMessages := newListMessages()
+	pageToken := ""
+	startFlag := true
+
+	for startFlag || pageToken != "" {
+		// Retrieve a page of messages based on the filter and current page token.
+		listMessagesResp, err := client.ListMessages(ctx, user, filter.Query(), pageToken)
+		if err != nil {
+			return listMessages, err
+		}
+		// Add the retrieved messages to the list and update the result size estimate.
+		// Every page has the estimate of the whole result, so only the first one counts.
+		estimate := listMessagesResp.ResultSizeEstimate
+		if !startFlag {
+			estimate = 0
+		}
+		listMessages.addList(listMessagesResp.Messages, estimate)
+		progress.listed(len(listMessagesResp.Messages), estimate)
+		// Update the page token for the next iteration.
+		pageToken = listMessagesResp.NextPageToken
+		startFlag = false
+		// Introduce a short delay to avoid hitting rate limits.
+		// There is probably a short delay between when a next_page_token is issued and when it will become valid.
+		// https://stackoverflow.com/questions/41994292/trouble-looping-through-google-places-api-with-pagetoken-in-go
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return listMessages, nil
+}
+
+// fetch retrieves a single message with both the parsed payload and the raw content.
+func fetch(ctx context.Context, client gmailapi.IClient, user string, id string) (*gmail.Message, error) {
+	// "full" (default) - Returns the full email message data with body content
+	// Parsed in the `payload` field; the `raw` field is not used
+	message, err := client.GetMessage(ctx, user, id, "full")
+	if err != nil {
+		return nil, err
+	}
+	// "raw" - Returns the full email message data with body content in the `raw`
+	// field as a base64url encoded string; the `payload` field is not used
+	message1, err := client.GetMessage(ctx, user, id, "raw")
+	if err != nil {
+		return nil, err
+	}
+	message.Raw = message1.Raw
+	return message, nil
+}
+
+// searchThreads retrieves the IDs of threads with messages matching the filter, like search does for messages.
+func searchThreads(ctx context.Context, client gmailapi.IClient, user string, filter TFilter, progress *tProgress) ([]*gmail.Thread, error) {
+	threads := make([]*gmail.Thread, 0)
+	pageToken := ""
+	startFlag := true
+
+	for startFlag || pageToken != "" {
+		listThreadsResp, err := client.ListThreads(ctx, user, filter.Query(), pageToken)
+		if err != nil {
+			return threads, err
+		}
+		threads = append(threads, listThreadsResp.Threads...)
+		progress.listed(len(listThreadsResp.Threads), listThreadsResp.ResultSizeEstimate)
+		pageToken = listThreadsResp.NextPageToken
+		startFlag = false
+		// The same delay as in search, for the same reason.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return threads, nil
+}
+
+// fetchThread retrieves a thread with its messages, oldest first, each with both the parsed payload and the raw content.
+func fetchThread(ctx context.Context, client gmailapi.IClient, user string, id string) (*gmail.Thread, error) {
+	thread, err := client.GetThread(ctx, user, id, "full")
+	if err != nil {
+		return nil, err
+	}
+	// Threads are not available in the "raw" format
+	for _, message := range thread.Messages {
+		message1, err := client.GetMessage(ctx, user, message.Id, "raw")
+		if err != nil {
+			return nil, err
+		}
+		message.Raw = message1.Raw
+	}
+	return thread, nil
+}
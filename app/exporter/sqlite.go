@@ -0,0 +1,329 @@
+package exporter
+
+import (
+	"database/sql"
+	"fmt"
+	"gmailexport/app/areas"
+	"net/mail"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the sqlite archive. Messages are upserted by Gmail ID;
+// the other tables refer to them by message_id. messages_fts is the full-text index of the
+// subject and the plain text body.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	thread_id TEXT,
+	internal_date INTEGER,
+	size_estimate INTEGER,
+	snippet TEXT,
+	rfc822_message_id TEXT,
+	date TEXT,
+	subject TEXT,
+	body TEXT
+);
+CREATE TABLE IF NOT EXISTS headers (
+	message_id TEXT NOT NULL REFERENCES messages(id),
+	position INTEGER NOT NULL,
+	name TEXT,
+	value TEXT
+);
+CREATE TABLE IF NOT EXISTS labels (
+	id TEXT PRIMARY KEY,
+	name TEXT
+);
+CREATE TABLE IF NOT EXISTS message_labels (
+	message_id TEXT NOT NULL REFERENCES messages(id),
+	label_id TEXT NOT NULL REFERENCES labels(id),
+	PRIMARY KEY (message_id, label_id)
+);
+CREATE TABLE IF NOT EXISTS addresses (
+	message_id TEXT NOT NULL REFERENCES messages(id),
+	field TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	name TEXT,
+	address TEXT
+);
+CREATE TABLE IF NOT EXISTS attachments (
+	message_id TEXT NOT NULL REFERENCES messages(id),
+	part_id TEXT,
+	filename TEXT,
+	mime_type TEXT,
+	size INTEGER,
+	attachment_id TEXT
+);
+CREATE INDEX IF NOT EXISTS headers_message ON headers(message_id);
+CREATE INDEX IF NOT EXISTS addresses_message ON addresses(message_id);
+CREATE INDEX IF NOT EXISTS addresses_address ON addresses(address);
+CREATE INDEX IF NOT EXISTS attachments_message ON attachments(message_id);
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(message_id UNINDEXED, subject, body);
+`
+
+// addressFields are the headers stored in the addresses table, by the field name they get there
+var addressFields = map[string]string{"From": "from", "To": "to", "Cc": "cc", "Bcc": "bcc", "Reply-To": "reply-to"}
+
+// TSqliteMessage is a message of the sqlite format
+type TSqliteMessage struct {
+	Id           string              `json:"id"`
+	ThreadId     string              `json:"threadId"`
+	InternalDate int64               `json:"internalDate"`
+	SizeEstimate int64               `json:"sizeEstimate"`
+	Snippet      string              `json:"snippet"`
+	MessageId    string              `json:"messageId"`
+	Date         string              `json:"date"`
+	Subject      string              `json:"subject"`
+	Body         string              `json:"body"`
+	Headers      []TSqliteHeader     `json:"headers"`
+	Labels       []TSqliteLabel      `json:"labels"`
+	Addresses    []TSqliteAddress    `json:"addresses"`
+	Attachments  []TSqliteAttachment `json:"attachments"`
+}
+
+// TSqliteHeader is a header of TSqliteMessage
+type TSqliteHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// TSqliteLabel is a label of TSqliteMessage
+type TSqliteLabel struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TSqliteAddress is an address of a From, To, Cc, Bcc or Reply-To header of TSqliteMessage
+type TSqliteAddress struct {
+	Field   string `json:"field"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// TSqliteAttachment describes an attached file of TSqliteMessage, without its content
+type TSqliteAttachment struct {
+	PartId       string `json:"partId"`
+	Filename     string `json:"filename"`
+	MimeType     string `json:"mimeType"`
+	Size         int64  `json:"size"`
+	AttachmentId string `json:"attachmentId"`
+}
+
+func init() {
+	registerFormat(tFormat{
+		name:        "sqlite",
+		description: "an archive database of messages, headers, labels, addresses and attachments with full-text search",
+		records: func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) (any, error) {
+			return toSqliteRows(messages, annotations)
+		},
+		open: func(statement TStatement) (iOutput, error) {
+			return newSqliteOutput(statement)
+		},
+		updates: true,
+	})
+}
+
+// newSqliteMessage returns the archive record of the message
+func newSqliteMessage(message *gmail.Message, annotations areas.TAnnotations) (TSqliteMessage, error) {
+	small, err := areas.PrepareSmallArea(message, annotations)
+	if err != nil {
+		return TSqliteMessage{}, err
+	}
+	easy, err := areas.PrepareEasyArea(message, annotations)
+	if err != nil {
+		return TSqliteMessage{}, err
+	}
+	record := TSqliteMessage{
+		Id:           small.Id,
+		ThreadId:     small.ThreadId,
+		InternalDate: small.InternalDate,
+		SizeEstimate: small.SizeEstimate,
+		Snippet:      small.Snippet,
+		MessageId:    small.MessageId,
+		Date:         small.Date,
+		Subject:      small.Subject,
+		Body:         easy.PlainText,
+	}
+	for _, h := range easy.Headers {
+		record.Headers = append(record.Headers, TSqliteHeader{Name: h.Name, Value: h.Value})
+		field, ok := addressFields[h.Name]
+		if !ok {
+			continue
+		}
+		list, err := mail.ParseAddressList(h.Value)
+		if err != nil {
+			record.Addresses = append(record.Addresses, TSqliteAddress{Field: field, Address: strings.TrimSpace(h.Value)})
+			continue
+		}
+		for _, a := range list {
+			record.Addresses = append(record.Addresses, TSqliteAddress{Field: field, Name: a.Name, Address: strings.ToLower(a.Address)})
+		}
+	}
+	names := small.LabelNames
+	for i, id := range small.LabelIds {
+		label := TSqliteLabel{Id: id, Name: id}
+		if i < len(names) {
+			label.Name = names[i]
+		}
+		record.Labels = append(record.Labels, label)
+	}
+	record.Attachments = sqliteAttachments(message.Payload, record.Attachments)
+	return record, nil
+}
+
+// sqliteAttachments appends the parts with a file name to the attachments
+func sqliteAttachments(part *gmail.MessagePart, attachments []TSqliteAttachment) []TSqliteAttachment {
+	if part == nil {
+		return attachments
+	}
+	if part.Filename != "" {
+		attachment := TSqliteAttachment{PartId: part.PartId, Filename: part.Filename, MimeType: part.MimeType}
+		if part.Body != nil {
+			attachment.Size = part.Body.Size
+			attachment.AttachmentId = part.Body.AttachmentId
+		}
+		attachments = append(attachments, attachment)
+	}
+	for _, p := range part.Parts {
+		attachments = sqliteAttachments(p, attachments)
+	}
+	return attachments
+}
+
+// toSqliteRows returns the records of the messages
+func toSqliteRows(messages []*gmail.Message, annotations []areas.TAnnotations) ([]TSqliteMessage, error) {
+	records := make([]TSqliteMessage, 0, len(messages))
+	for i, message := range messages {
+		record, err := newSqliteMessage(message, annotations[i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// tSqliteOutput upserts the messages into a sqlite database, one transaction per result.
+// The database is created, or opened if it exists, with the first message.
+type tSqliteOutput struct {
+	path string
+	db   *sql.DB
+}
+
+// newSqliteOutput returns the sqlite output defined by the statement
+func newSqliteOutput(statement TStatement) (*tSqliteOutput, error) {
+	if statement.Split {
+		return nil, fmt.Errorf("the sqlite format cannot be split")
+	}
+	if statement.Output == "stdout" {
+		return nil, fmt.Errorf("the sqlite format needs an output file")
+	}
+	if len(statement.EncryptTo) > 0 {
+		// The database is written in place, so it cannot be encrypted as a stream
+		return nil, fmt.Errorf("the sqlite format cannot be encrypted")
+	}
+	if statement.Compress != "" {
+		return nil, fmt.Errorf("the sqlite format cannot be compressed")
+	}
+	return &tSqliteOutput{path: statement.Output}, nil
+}
+
+// openSqlite opens the archive database and creates the missing tables
+func openSqlite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create sqlite schema: %w", err)
+	}
+	return db, nil
+}
+
+func (out *tSqliteOutput) write(result TResult) (tLocation, error) {
+	location := tLocation{file: out.path}
+	records, ok := result.records.([]TSqliteMessage)
+	if !ok {
+		return location, fmt.Errorf("the sqlite output takes sqlite records, not %T", result.records)
+	}
+	if out.db == nil {
+		db, err := openSqlite(out.path)
+		if err != nil {
+			return location, err
+		}
+		out.db = db
+	}
+	tx, err := out.db.Begin()
+	if err != nil {
+		return location, err
+	}
+	for _, record := range records {
+		err = upsertSqliteMessage(tx, record)
+		if err != nil {
+			tx.Rollback()
+			return location, err
+		}
+	}
+	return location, tx.Commit()
+}
+
+// upsertSqliteMessage inserts the message, or replaces it and everything that refers to it
+func upsertSqliteMessage(tx *sql.Tx, record TSqliteMessage) error {
+	_, err := tx.Exec(`INSERT INTO messages (id, thread_id, internal_date, size_estimate, snippet, rfc822_message_id, date, subject, body)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET thread_id = excluded.thread_id, internal_date = excluded.internal_date,
+			size_estimate = excluded.size_estimate, snippet = excluded.snippet, rfc822_message_id = excluded.rfc822_message_id,
+			date = excluded.date, subject = excluded.subject, body = excluded.body`,
+		record.Id, record.ThreadId, record.InternalDate, record.SizeEstimate, record.Snippet, record.MessageId, record.Date, record.Subject, record.Body)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"headers", "message_labels", "addresses", "attachments", "messages_fts"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE message_id = ?", record.Id)
+		if err != nil {
+			return err
+		}
+	}
+	for i, h := range record.Headers {
+		_, err = tx.Exec("INSERT INTO headers (message_id, position, name, value) VALUES (?, ?, ?, ?)", record.Id, i, h.Name, h.Value)
+		if err != nil {
+			return err
+		}
+	}
+	for _, l := range record.Labels {
+		_, err = tx.Exec("INSERT INTO labels (id, name) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET name = excluded.name", l.Id, l.Name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO message_labels (message_id, label_id) VALUES (?, ?)", record.Id, l.Id)
+		if err != nil {
+			return err
+		}
+	}
+	for i, a := range record.Addresses {
+		_, err = tx.Exec("INSERT INTO addresses (message_id, field, position, name, address) VALUES (?, ?, ?, ?, ?)", record.Id, a.Field, i, a.Name, a.Address)
+		if err != nil {
+			return err
+		}
+	}
+	for _, a := range record.Attachments {
+		_, err = tx.Exec("INSERT INTO attachments (message_id, part_id, filename, mime_type, size, attachment_id) VALUES (?, ?, ?, ?, ?, ?)",
+			record.Id, a.PartId, a.Filename, a.MimeType, a.Size, a.AttachmentId)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT INTO messages_fts (message_id, subject, body) VALUES (?, ?, ?)", record.Id, record.Subject, record.Body)
+	return err
+}
+
+func (out *tSqliteOutput) close() error {
+	if out.db == nil {
+		return nil
+	}
+	return out.db.Close()
+}
@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Test the archive is searchable and a second run updates the messages instead of adding them again
+func TestExportSqlite(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "archive.db")
+	statement := TStatement{Output: path, Format: "sqlite", Area: "all"}
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.Exported)
+	id := mailbox.AddLabel(&gmail.Label{Name: "Projects/Plan"})
+	list, err := mailbox.ListMessages(context.Background(), "me", "subject:Plan", "")
+	require.NoError(t, err)
+	for _, m := range list.Messages {
+		mailbox.ModifyLabels(m.Id, []string{id}, nil)
+	}
+	_, err = NewWithClient(mailbox, "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+	count := func(query string, args ...interface{}) int {
+		var n int
+		require.NoError(t, db.QueryRow(query, args...).Scan(&n))
+		return n
+	}
+	assert.Equal(t, 3, count("SELECT COUNT(*) FROM messages"))
+	assert.Equal(t, 3, count("SELECT COUNT(*) FROM messages_fts"))
+	assert.Equal(t, 2, count("SELECT COUNT(*) FROM message_labels JOIN labels ON labels.id = label_id WHERE labels.name = 'Projects/Plan'"))
+	assert.Equal(t, 1, count("SELECT COUNT(*) FROM addresses WHERE field = 'cc' AND address = 'carol@example.com'"))
+	assert.Equal(t, 17, count("SELECT COUNT(*) FROM headers"))
+
+	var subject string
+	require.NoError(t, db.QueryRow("SELECT m.subject FROM messages_fts f JOIN messages m ON m.id = f.message_id WHERE messages_fts MATCH 'sure'").Scan(&subject))
+	assert.Equal(t, "Re: Plan", subject)
+}
+
+func TestExportSqliteAttachments(t *testing.T) {
+	mailbox := newTestMailbox(t, 0)
+	mailbox.AddMessage(attachmentMessage(t, "Invoice"))
+	path := filepath.Join(t.TempDir(), "archive.db")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "sqlite", Area: "all"}).Export(context.Background())
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+	var filename, mimeType string
+	var size int64
+	require.NoError(t, db.QueryRow("SELECT filename, mime_type, size FROM attachments").Scan(&filename, &mimeType, &size))
+	assert.Equal(t, "invoice.pdf", filename)
+	assert.Equal(t, "application/pdf", mimeType)
+	assert.Equal(t, int64(3), size)
+}
+
+func TestSqliteNeedsFile(t *testing.T) {
+	_, err := newOutput(TStatement{Output: "stdout", Format: "sqlite"})
+	assert.Error(t, err)
+}
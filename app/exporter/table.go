@@ -0,0 +1,183 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"gmailexport/app/areas"
+	"html"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// TableColumns are the columns of the csv and tsv formats, in the default order
+var TableColumns = []string{"id", "date", "from", "to", "subject", "labels", "snippet", "size", "attachments"}
+
+// DefaultSeparator joins the values of multi-valued columns such as labels
+const DefaultSeparator = "; "
+
+// bom makes Excel read a CSV file as UTF-8
+const bom = "\ufeff"
+
+// tableColumn returns the value of a column of the message
+type tableColumn func(m *gmail.Message, annotations areas.TAnnotations, separator string) string
+
+var tableColumns = map[string]tableColumn{
+	"id": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return m.Id
+	},
+	"date": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return time.UnixMilli(m.InternalDate).UTC().Format(time.RFC3339)
+	},
+	"from": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return formatAddresses(messageHeader(m, "From"), separator)
+	},
+	"to": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return formatAddresses(messageHeader(m, "To"), separator)
+	},
+	"subject": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return messageHeader(m, "Subject")
+	},
+	"labels": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return strings.Join(annotations.LabelNames, separator)
+	},
+	"snippet": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		// Gmail returns the snippet with HTML entities
+		return html.UnescapeString(m.Snippet)
+	},
+	"size": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return strconv.FormatInt(m.SizeEstimate, 10)
+	},
+	"attachments": func(m *gmail.Message, annotations areas.TAnnotations, separator string) string {
+		return strconv.Itoa(countAttachments(m.Payload))
+	},
+}
+
+// tTable formats messages as rows of a CSV or TSV file, quoted according to RFC 4180
+type tTable struct {
+	columns   []string
+	comma     rune
+	separator string
+}
+
+func init() {
+	for _, name := range []string{"csv", "tsv"} {
+		registerFormat(tFormat{
+			name:        name,
+			description: "a header and a row per message with the chosen columns, quoted according to RFC 4180",
+			rows: func(messages []*gmail.Message, annotations []areas.TAnnotations, statement TStatement) ([]byte, error) {
+				table, err := newTable(statement)
+				if err != nil {
+					return nil, err
+				}
+				return table.rows(messages, annotations)
+			},
+			header: tableHeader,
+		})
+	}
+}
+
+// newTable returns the table of the csv or tsv format with the columns of the statement
+func newTable(statement TStatement) (*tTable, error) {
+	table := &tTable{columns: statement.Columns, comma: ',', separator: statement.Separator}
+	if statement.Format == "tsv" {
+		table.comma = '\t'
+	}
+	if len(table.columns) == 0 {
+		table.columns = TableColumns
+	}
+	if table.separator == "" {
+		table.separator = DefaultSeparator
+	}
+	for _, column := range table.columns {
+		if tableColumns[column] == nil {
+			return nil, fmt.Errorf("unknown column %q, the columns are %s", column, strings.Join(TableColumns, ", "))
+		}
+	}
+	return table, nil
+}
+
+// header returns the header row, after the BOM if withBOM is set
+func (table *tTable) header(withBOM bool) ([]byte, error) {
+	b, err := table.write([][]string{table.columns})
+	if err != nil {
+		return nil, err
+	}
+	if withBOM {
+		b = append([]byte(bom), b...)
+	}
+	return b, nil
+}
+
+// rows returns a row for each message
+func (table *tTable) rows(messages []*gmail.Message, annotations []areas.TAnnotations) ([]byte, error) {
+	records := make([][]string, len(messages))
+	for i, m := range messages {
+		records[i] = make([]string, len(table.columns))
+		for j, column := range table.columns {
+			records[i][j] = tableColumns[column](m, annotations[i], table.separator)
+		}
+	}
+	return table.write(records)
+}
+
+func (table *tTable) write(records [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = table.comma
+	w.UseCRLF = true
+	err := w.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tableHeader returns what starts every csv or tsv file of the statement
+func tableHeader(statement TStatement) (string, error) {
+	table, err := newTable(statement)
+	if err != nil {
+		return "", err
+	}
+	b, err := table.header(statement.BOM)
+	return string(b), err
+}
+
+// formatAddresses returns the addresses of an address list header joined with the separator,
+// each as "Name <address>" or "address". A value that is not a valid address list is returned as it is.
+func formatAddresses(value, separator string) string {
+	if value == "" {
+		return ""
+	}
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return value
+	}
+	addresses := make([]string, len(list))
+	for i, a := range list {
+		addresses[i] = a.Address
+		if a.Name != "" {
+			addresses[i] = a.Name + " <" + a.Address + ">"
+		}
+	}
+	return strings.Join(addresses, separator)
+}
+
+// countAttachments returns the number of parts with a file name
+func countAttachments(part *gmail.MessagePart) int {
+	if part == nil {
+		return 0
+	}
+	count := 0
+	if part.Filename != "" {
+		count++
+	}
+	for _, p := range part.Parts {
+		count += countAttachments(p)
+	}
+	return count
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"context"
+	"gmailexport/app/gmailapi/fake"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestExportCsv(t *testing.T) {
+	mailbox := fake.New()
+	id := mailbox.AddLabel(&gmail.Label{Name: "Work"})
+	message, err := fake.ParseMessage([]byte("From: \"Doe, John\" <john@example.com>\r\nTo: a@example.com, B <b@example.com>\r\n" +
+		"Subject: Invoice \"May\"\r\nDate: Mon, 3 May 2021 10:00:00 +0000\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nTotal: 1,000\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=invoice.pdf\r\n\r\nPDF\r\n--b--\r\n"))
+	require.NoError(t, err)
+	message.Id = "1"
+	mailbox.AddMessage(message)
+	mailbox.ModifyLabels("1", []string{id}, nil)
+	path := filepath.Join(t.TempDir(), "out.csv")
+
+	_, err = NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "csv", Area: "all",
+		Columns: []string{"id", "from", "to", "subject", "labels", "attachments"}, Separator: "|", BOM: true}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "\ufeffid,from,to,subject,labels,attachments\r\n"+
+		"1,\"Doe, John <john@example.com>\",a@example.com|B <b@example.com>,\"Invoice \"\"May\"\"\",INBOX|Work,1\r\n", string(b))
+}
+
+func TestExportTsvSplit(t *testing.T) {
+	mailbox := newTestMailbox(t, 2)
+	dir := t.TempDir()
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: filepath.Join(dir, "message.tsv"), Split: true, Format: "tsv", Area: "all",
+		Columns: []string{"id", "date", "subject"}}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "message_1.tsv"))
+	require.NoError(t, err)
+	assert.Equal(t, "id\tdate\tsubject\r\n1\t2021-05-01T10:00:00Z\tMessage 1\r\n", string(b))
+}
+
+// Test a thread is written as a row per message
+func TestExportCsvByThread(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "out.csv")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{Subject: "Plan"}, TStatement{Output: path, Format: "csv", Area: "all",
+		ByThread: true, Columns: []string{"subject"}}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Exported)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "subject\r\nPlan\r\nRe: Plan\r\n", string(b))
+}
+
+func TestNewTableUnknownColumn(t *testing.T) {
+	_, err := newOutput(TStatement{Output: "stdout", Format: "csv", Columns: []string{"id", "body"}})
+	assert.ErrorContains(t, err, `unknown column "body"`)
+}
+
+// Test the row formats refuse an area they would ignore, but not with a template
+func TestExportCsvArea(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewWithClient(newTestMailbox(t, 1), "me", TFilter{}, TStatement{Output: filepath.Join(dir, "out.csv"), Format: "csv", Area: "small"}).Export(context.Background())
+	assert.ErrorContains(t, err, "the csv format writes the same fields for every area, it cannot export the small area")
+	_, err = os.Stat(filepath.Join(dir, "out.csv"))
+	assert.True(t, os.IsNotExist(err))
+
+	template := filepath.Join(dir, "subject.tmpl")
+	require.NoError(t, os.WriteFile(template, []byte("{{.Subject}}\n"), 0o600))
+	_, err = NewWithClient(newTestMailbox(t, 1), "me", TFilter{}, TStatement{Output: filepath.Join(dir, "subjects.csv"), Format: "csv", Area: "small", Template: template}).Export(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(dir, "subjects.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "Message 1\n", string(b))
+}
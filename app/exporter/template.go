@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the helper functions of the user templates
+var templateFuncs = template.FuncMap{
+	"date":      formatDate,
+	"addresses": splitAddresses,
+	"emails":    parseAddresses,
+	"name":      addressName,
+	"truncate":  truncate,
+	"join":      strings.Join,
+	"trim":      strings.TrimSpace,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// tTemplate renders the prepared messages with a user template. The template file renders a message
+// (or a thread when exporting by thread); it may define "header" and "footer", which are rendered
+// with the statement at the start and at the end of every output file.
+type tTemplate struct {
+	template *template.Template
+}
+
+// loadTemplate parses the template file
+func loadTemplate(path string) (*tTemplate, error) {
+	t, err := template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tTemplate{template: t}, nil
+}
+
+// render returns the prepared message rendered with the template
+func (t *tTemplate) render(area any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := t.template.Execute(&buf, area)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// frame returns the rendered header and footer, "" for those the template does not define
+func (t *tTemplate) frame(statement TStatement) (header, footer string, err error) {
+	header, err = t.renderDefined("header", statement)
+	if err != nil {
+		return "", "", err
+	}
+	footer, err = t.renderDefined("footer", statement)
+	if err != nil {
+		return "", "", err
+	}
+	return header, footer, nil
+}
+
+func (t *tTemplate) renderDefined(name string, data any) (string, error) {
+	if t.template.Lookup(name) == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	err := t.template.ExecuteTemplate(&buf, name, data)
+	return buf.String(), err
+}
+
+// formatDate formats a date with the layout of package time, e.g. "2006-01-02".
+// The date is an internal date (epoch ms, as int64 or string), a time.Time or a Date header.
+// A value that is not a date is returned as it is.
+func formatDate(layout string, value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(layout)
+	case int64:
+		return time.UnixMilli(v).UTC().Format(layout)
+	case string:
+		if t, err := mail.ParseDate(v); err == nil {
+			return t.Format(layout)
+		}
+		var ms int64
+		if _, err := fmt.Sscan(v, &ms); err == nil {
+			return time.UnixMilli(ms).UTC().Format(layout)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// addressName returns the display name of the first address of the header, or its address if it has no name
+func addressName(value string) string {
+	list, err := mail.ParseAddressList(value)
+	if err != nil || len(list) == 0 {
+		return value
+	}
+	if list[0].Name != "" {
+		return list[0].Name
+	}
+	return list[0].Address
+}
+
+// truncate shortens the text to n characters, ending with "…" if it was cut
+func truncate(n int, text string) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	if n < 1 {
+		return ""
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTemplate writes the template to a file and returns its path
+func writeTemplate(t *testing.T, text string) string {
+	path := filepath.Join(t.TempDir(), "message.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	return path
+}
+
+func TestExportTemplate(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	template := writeTemplate(t, `{{define "header"}}Export of {{.Area}}
+{{end}}{{define "footer"}}End
+{{end}}{{date "2006-01-02" .InternalDate}} {{name .From}} <{{join (emails .From) ","}}>: {{truncate 6 .Subject}}
+`)
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small", Template: template}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Export of small\n"+
+		"2021-05-05 dave@example.com <dave@example.com>: Other\n"+
+		"2021-05-04 Bob <bob@example.com>: Re: P…\n"+
+		"2021-05-03 Alice <alice@example.com>: Plan\n"+
+		"End\n", string(b))
+}
+
+// Test the template renders threads when exporting by thread, with a file per thread and header
+func TestExportTemplateByThreadSplit(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	template := writeTemplate(t, `{{define "header"}}# {{end}}{{.ThreadId}}:{{range .Messages}} {{.Subject}}{{end}}`)
+	dir := t.TempDir()
+
+	_, err := NewWithClient(mailbox, "me", TFilter{Subject: "Plan"}, TStatement{Output: filepath.Join(dir, "thread.txt"), Split: true, Area: "small", ByThread: true, Template: template}).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "thread_0.txt"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^# \w+: Plan Re: Plan$`, string(b))
+}
+
+func TestExportTemplateError(t *testing.T) {
+	mailbox := newTestMailbox(t, 1)
+	template := writeTemplate(t, `{{.Unknown}}`)
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: "stdout", Area: "small", Template: template}).Export(context.Background())
+	assert.ErrorContains(t, err, "Unknown")
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	assert.Equal(t, "2021-05-03", formatDate("2006-01-02", "Mon, 3 May 2021 10:00:00 +0000"))
+	assert.Equal(t, "2021-05-03", formatDate("2006-01-02", "1620036000000"))
+	assert.Equal(t, "2021-05-03", formatDate("2006-01-02", time.Date(2021, 5, 3, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "soon", formatDate("2006-01-02", "soon"))
+	assert.Equal(t, "Bob", addressName("Bob <bob@example.com>, carol@example.com"))
+	assert.Equal(t, []string{"Bob <bob@example.com>", "carol@example.com"}, splitAddresses("Bob <bob@example.com>, carol@example.com"))
+	assert.Equal(t, "héllo", truncate(5, "héllo"))
+	assert.Equal(t, "hé…", truncate(3, "héllo"))
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/redact"
+	"net/mail"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// TThread groups the prepared messages of a Gmail thread
+type TThread struct {
+	// ThreadId: The ID of the thread.
+	ThreadId string `json:"threadId"`
+	// Participants: The email addresses in the From, To and Cc headers of the messages, in order of appearance.
+	Participants []string `json:"participants"`
+	// FirstDate: The internal date of the first message in RFC 3339 format.
+	FirstDate string `json:"firstDate"`
+	// LastDate: The internal date of the last message in RFC 3339 format.
+	LastDate string `json:"lastDate"`
+	// MessageCount: The number of messages in the thread.
+	MessageCount int `json:"messageCount"`
+	// Messages: The messages of the thread prepared according to the area, oldest first
+	// or in the order of the rebuilt conversation.
+	Messages []any `json:"messages"`
+	// Redactions: The redaction rules that changed the participants, if the thread was redacted.
+	Redactions []string `json:"redactions,omitempty"`
+}
+
+// newThread returns the thread of the Gmail messages and their prepared versions.
+// With a redaction session the participants are taken from the redacted headers.
+func newThread(id string, messages []*gmail.Message, prepared []any, s *redact.TSession) *TThread {
+	thread := &TThread{ThreadId: id, MessageCount: len(messages), Messages: prepared}
+	seen := make(map[string]bool)
+	var first, last int64
+	for i, m := range messages {
+		if i == 0 || m.InternalDate < first {
+			first = m.InternalDate
+		}
+		if i == 0 || m.InternalDate > last {
+			last = m.InternalDate
+		}
+		if m.Payload == nil {
+			continue
+		}
+		for _, h := range m.Payload.Headers {
+			if h.Name != "From" && h.Name != "To" && h.Name != "Cc" {
+				continue
+			}
+			value := h.Value
+			if s != nil {
+				var keep bool
+				value, keep = s.Header(h.Name, value)
+				if !keep {
+					continue
+				}
+			}
+			for _, address := range parseAddresses(value) {
+				if !seen[address] {
+					seen[address] = true
+					thread.Participants = append(thread.Participants, address)
+				}
+			}
+		}
+	}
+	thread.FirstDate = time.UnixMilli(first).UTC().Format(time.RFC3339)
+	thread.LastDate = time.UnixMilli(last).UTC().Format(time.RFC3339)
+	if s != nil {
+		thread.Redactions = s.Fired()
+	}
+	return thread
+}
+
+// parseAddresses returns the email addresses of an address list header in lower case.
+// A value that is not a valid address list is returned as it is.
+func parseAddresses(value string) []string {
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return []string{strings.ToLower(strings.TrimSpace(value))}
+	}
+	addresses := make([]string, len(list))
+	for i, a := range list {
+		addresses[i] = strings.ToLower(a.Address)
+	}
+	return addresses
+}
+
+// String method returns a formatted string representation of TThread
+func (th TThread) String() string {
+	St := ""
+	St = St + fmt.Sprintf("%s: %s\r\n", "Thread ID", th.ThreadId)
+	St = St + fmt.Sprintf("%s: ", "Participants")
+	for _, participant := range th.Participants {
+		St = St + fmt.Sprintf("%s, ", participant)
+	}
+	St = St + fmt.Sprintf("%s\r\n", "")
+	St = St + fmt.Sprintf("%s: %s\r\n", "First Date", th.FirstDate)
+	St = St + fmt.Sprintf("%s: %s\r\n", "Last Date", th.LastDate)
+	St = St + fmt.Sprintf("%s: %v\r\n", "Message Count", th.MessageCount)
+	for i, message := range th.Messages {
+		St = St + fmt.Sprintf("--- Message %d of %d ---\r\n", i+1, th.MessageCount)
+		b, err := toTxt(message)
+		if err == nil {
+			St = St + string(b)
+		}
+	}
+	if len(th.Redactions) > 0 {
+		St = St + fmt.Sprintf("%s: ", "Redactions")
+		for _, rule := range th.Redactions {
+			St = St + fmt.Sprintf("%s, ", rule)
+		}
+		St = St + fmt.Sprintf("%s\r\n", "")
+	}
+	return St
+}
+
+// ToJson method converts the TThread structure to a JSON byte array.
+func (th TThread) ToJson() ([]byte, error) {
+	b, err := json.Marshal(th)
+	return b, err
+}
+
+// ToTxt method converts the TThread structure to a plain text byte array.
+func (th TThread) ToTxt() ([]byte, error) {
+	b := []byte(th.String())
+	return b, nil
+}
@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"context"
+	"gmailexport/app/gmailapi/fake"
+	"gmailexport/app/redact"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newThreadMailbox returns a mailbox with a thread of a message and a reply, and a separate message
+func newThreadMailbox(t *testing.T) *fake.Mailbox {
+	mailbox := fake.New()
+	for _, raw := range []string{
+		"From: Alice <alice@example.com>\r\nTo: bob@example.com\r\nSubject: Plan\r\nDate: Mon, 3 May 2021 10:00:00 +0000\r\nMessage-ID: <plan@example.com>\r\n\r\nLet's plan.\r\n",
+		"From: Bob <bob@example.com>\r\nTo: alice@example.com\r\nCc: Carol <carol@example.com>\r\nSubject: Re: Plan\r\nDate: Tue, 4 May 2021 10:00:00 +0000\r\nMessage-ID: <re-plan@example.com>\r\nIn-Reply-To: <plan@example.com>\r\n\r\nSure.\r\n",
+		"From: dave@example.com\r\nTo: alice@example.com\r\nSubject: Other\r\nDate: Wed, 5 May 2021 10:00:00 +0000\r\nMessage-ID: <other@example.com>\r\n\r\nOther.\r\n",
+	} {
+		message, err := fake.ParseMessage([]byte(raw))
+		require.NoError(t, err)
+		mailbox.AddMessage(message)
+	}
+	return mailbox
+}
+
+func TestExportByThread(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	summary, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: path, Format: "json", Area: "small", ByThread: true}).Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TSummary{Found: 2, Exported: 2}, summary)
+
+	threads := readJson(t, path)
+	require.Len(t, threads, 2)
+	thread := threads[1]
+	assert.Equal(t, []interface{}{"alice@example.com", "bob@example.com", "carol@example.com"}, thread["participants"])
+	assert.Equal(t, "2021-05-03T10:00:00Z", thread["firstDate"])
+	assert.Equal(t, "2021-05-04T10:00:00Z", thread["lastDate"])
+	assert.Equal(t, float64(2), thread["messageCount"])
+	messages := thread["messages"].([]interface{})
+	require.Len(t, messages, 2)
+	assert.Equal(t, "Plan", messages[0].(map[string]interface{})["subject"])
+	assert.Equal(t, "Re: Plan", messages[1].(map[string]interface{})["subject"])
+}
+
+// Test the participants of a redacted thread are masked like the headers of its messages
+func TestExportByThreadRedacted(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	path := filepath.Join(t.TempDir(), "out.txt")
+	config := redact.TConfig{MaskEmails: true}
+
+	_, err := NewWithClient(mailbox, "me", TFilter{Subject: "Plan"}, TStatement{Output: path, Format: "txt", Area: "small", ByThread: true, Redact: &config}).Export(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "Participants: ***@example.com, \r\n")
+	assert.Contains(t, string(b), "Redactions: email, \r\n")
+	assert.NotContains(t, string(b), "alice@")
+	assert.NotContains(t, string(b), "carol@")
+}
+
+// Test the split output writes a file per thread
+func TestExportByThreadSplit(t *testing.T) {
+	mailbox := newThreadMailbox(t)
+	dir := t.TempDir()
+
+	_, err := NewWithClient(mailbox, "me", TFilter{}, TStatement{Output: filepath.Join(dir, "thread.txt"), Split: true, Format: "txt", Area: "raw", ByThread: true}).Export(context.Background())
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	// A file per thread and the manifest
+	assert.Len(t, entries, 3)
+	b, err := os.ReadFile(filepath.Join(dir, "thread_1.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "Message Count: 2\r\n--- Message 1 of 2 ---\r\n")
+	assert.Contains(t, string(b), "Subject: Re: Plan")
+}
@@ -0,0 +1,263 @@
+package exporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// iOutput receives formatted messages one by one and writes them to the destination
+type iOutput interface {
+	// write writes the block, or the records, of the result and returns where it was written.
+	write(result TResult) (tLocation, error)
+	close() error
+}
+
+// tLocation is where a block is written: the path of a file, "stdout", or the path of an archive
+// and the name of its entry. The offset, size and SHA-256 are those of what was written for the block
+// in the content of the file or entry, before compression and encryption; sha256 is "" when the output
+// does not write the block itself, like the formats that write their own files.
+type tLocation struct {
+	file   string
+	entry  string
+	offset int64
+	bytes  int64
+	sha256 string
+}
+
+// digest records that the content was written at the offset of the location
+func (l *tLocation) digest(offset int64, content []byte) {
+	sum := sha256.Sum256(content)
+	l.offset = offset
+	l.bytes = int64(len(content))
+	l.sha256 = hex.EncodeToString(sum[:])
+}
+
+// newOutput returns the output defined by the statement
+func newOutput(statement TStatement) (iOutput, error) {
+	statement, err := resolveCompression(statement)
+	if err != nil {
+		return nil, err
+	}
+	if statement.Template != "" {
+		if statement.Append {
+			return nil, fmt.Errorf("only the ndjson format can be appended to an existing file")
+		}
+		return newTemplateOutput(statement)
+	}
+	format, err := lookupFormat(statement.Format)
+	if err != nil {
+		return nil, err
+	}
+	if statement.Append && !format.appendable {
+		return nil, fmt.Errorf("only the ndjson format can be appended to an existing file")
+	}
+	if statement.Append && len(statement.EncryptTo) > 0 {
+		return nil, fmt.Errorf("encrypted output cannot be appended to")
+	}
+	if statement.Append && statement.Split {
+		return nil, fmt.Errorf("split output cannot be appended to")
+	}
+	if format.open != nil {
+		return format.open(statement)
+	}
+	header := ""
+	if format.header != nil {
+		header, err = format.header(statement)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if statement.Split {
+		return newSplitOutput(statement, format.extension, header, "")
+	}
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	return &tSingleOutput{path: statement.Output, codec: codec, append: statement.Append, coma: format.coma, leftBracket: header + format.leftBracket, rightBracket: format.rightBracket}, nil
+}
+
+// newTemplateOutput returns the output of the messages rendered with the user template,
+// framed by its header and footer
+func newTemplateOutput(statement TStatement) (iOutput, error) {
+	t, err := loadTemplate(statement.Template)
+	if err != nil {
+		return nil, err
+	}
+	header, footer, err := t.frame(statement)
+	if err != nil {
+		return nil, err
+	}
+	if statement.Split {
+		return newSplitOutput(statement, "", header, footer)
+	}
+	codec, err := newCodec(statement)
+	if err != nil {
+		return nil, err
+	}
+	return &tSingleOutput{path: statement.Output, codec: codec, leftBracket: header, rightBracket: footer}, nil
+}
+
+// openOutput opens a new output file, or an existing one to append to, or returns stdout.
+// What is written goes through the codec, into a file with the extensions of the codec.
+func openOutput(path string, append bool, codec *tCodec) (io.WriteCloser, error) {
+	var file io.WriteCloser
+	var err error
+	switch {
+	case path == "stdout":
+		file = nopCloser{os.Stdout}
+	case codec.encryptor != nil:
+		file, err = os.OpenFile(outputPath(path, codec), os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0600)
+	case append:
+		file, err = os.OpenFile(outputPath(path, codec), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	default:
+		file, err = os.OpenFile(outputPath(path, codec), os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return codec.wrap(file)
+}
+
+// outputPath returns the path of the output file written through the codec
+func outputPath(path string, codec *tCodec) string {
+	if path == "stdout" {
+		return path
+	}
+	return path + codec.extension()
+}
+
+// nopCloser keeps stdout open when the output is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// tSingleOutput writes all messages to a single file or stdout, joined with delimiters.
+// The file is created with the first message, so nothing is created when nothing is found.
+type tSingleOutput struct {
+	path         string
+	codec        *tCodec
+	append       bool
+	coma         string
+	leftBracket  string
+	rightBracket string
+	file         io.WriteCloser
+	// offset is the size of the content of the file so far, including the content it was appended to
+	offset int64
+}
+
+func (out *tSingleOutput) write(result TResult) (tLocation, error) {
+	block := result.Block
+	var err error
+	delimiter := out.coma
+	if out.file == nil {
+		if out.append && out.path != "stdout" {
+			out.offset, err = contentSize(outputPath(out.path, out.codec))
+			if err != nil && !os.IsNotExist(err) {
+				return tLocation{}, err
+			}
+		}
+		out.file, err = openOutput(out.path, out.append, out.codec)
+		if err != nil {
+			return tLocation{}, err
+		}
+		delimiter = out.leftBracket
+	}
+	_, err = io.WriteString(out.file, delimiter)
+	if err != nil {
+		return tLocation{}, err
+	}
+	out.offset += int64(len(delimiter))
+	location := tLocation{file: outputPath(out.path, out.codec)}
+	location.digest(out.offset, block)
+	_, err = out.file.Write(block)
+	out.offset += int64(len(block))
+	return location, err
+}
+
+func (out *tSingleOutput) close() error {
+	if out.file == nil {
+		return nil
+	}
+	_, err := io.WriteString(out.file, out.rightBracket)
+	if err != nil {
+		out.file.Close()
+		return err
+	}
+	return out.file.Close()
+}
+
+// tSplitOutput writes each message to a separate file, or to a numbered entry of an archive.
+// With skipExisting the files are numbered after the existing ones; otherwise an existing file is an error.
+type tSplitOutput struct {
+	path         string
+	codec        *tCodec
+	archive      *tArchive
+	header       string
+	footer       string
+	count        int
+	skipExisting bool
+}
+
+func (out *tSplitOutput) write(result TResult) (tLocation, error) {
+	block := result.Block
+	content := out.entry(block)
+	if out.archive != nil {
+		name := generateFileName(out.path, strconv.Itoa(out.count))
+		out.count++
+		location := tLocation{file: outputPath(out.archive.path, out.archive.codec), entry: name}
+		location.digest(0, content)
+		return location, out.archive.add(name, content)
+	}
+	var file io.WriteCloser
+	var err error
+	var path string
+	for {
+		path = out.path
+		if path != "stdout" {
+			path = generateFileName(out.path, strconv.Itoa(out.count))
+		}
+		out.count++
+		file, err = openOutput(path, false, out.codec)
+		// Files of an earlier deduplicated export into the same directory are kept
+		if !out.skipExisting || !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return tLocation{}, err
+	}
+	location := tLocation{file: outputPath(path, out.codec)}
+	location.digest(0, content)
+	_, err = file.Write(content)
+	if err != nil {
+		file.Close()
+		return location, err
+	}
+	return location, file.Close()
+}
+
+func (out *tSplitOutput) close() error {
+	if out.archive != nil {
+		return out.archive.close()
+	}
+	return nil
+}
+
+// generateFileName creates a unique filename by appending a modifier to the base filename
+func generateFileName(basePath, modifier string) string {
+	dir := filepath.Dir(basePath)
+	file := filepath.Base(basePath)
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+
+	return filepath.Join(dir, name+"_"+modifier+ext)
+}
@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/encryption"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the single output joins messages with the format delimiters
+func TestSingleOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	out, err := newOutput(TStatement{Output: path, Format: "json"})
+	require.NoError(t, err)
+
+	_, err = out.write(TResult{Block: []byte(`{"id":"1"}`)})
+	require.NoError(t, err)
+	location, err := out.write(TResult{Block: []byte(`{"id":"2"}`)})
+	require.NoError(t, err)
+	// The offset of the second block follows the bracket, the first block and the comma
+	assert.Equal(t, path, location.file)
+	assert.Equal(t, int64(12), location.offset)
+	assert.Equal(t, int64(10), location.bytes)
+	require.NoError(t, out.close())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"id":"1"},{"id":"2"}]`, string(b))
+}
+
+// Test the single output creates no file when nothing was written
+func TestSingleOutputEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	out, err := newOutput(TStatement{Output: path, Format: "json"})
+	require.NoError(t, err)
+	require.NoError(t, out.close())
+
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// Test the split output writes each message to a numbered file
+func TestSplitOutput(t *testing.T) {
+	dir := t.TempDir()
+	out, err := newOutput(TStatement{Output: filepath.Join(dir, "gmail.txt"), Format: "txt", Split: true})
+	require.NoError(t, err)
+
+	_, err = out.write(TResult{Block: []byte("first")})
+	require.NoError(t, err)
+	location, err := out.write(TResult{Block: []byte("second")})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "gmail_1.txt"), location.file)
+	assert.Equal(t, int64(6), location.bytes)
+	require.NoError(t, out.close())
+
+	b, err := os.ReadFile(filepath.Join(dir, "gmail_1.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(b))
+}
+
+// Test the split output does not overwrite the files of an earlier export, and numbers
+// after them only for a deduplicated export
+func TestSplitOutputExisting(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gmail_0.txt"), []byte("old"), 0644))
+
+	out, err := newOutput(TStatement{Output: filepath.Join(dir, "gmail.txt"), Format: "txt", Split: true})
+	require.NoError(t, err)
+	_, err = out.write(TResult{Block: []byte("new")})
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	out, err = newOutput(TStatement{Output: filepath.Join(dir, "gmail.txt"), Format: "txt", Split: true, Dedup: "id"})
+	require.NoError(t, err)
+	location, err := out.write(TResult{Block: []byte("new")})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "gmail_1.txt"), location.file)
+	b, err := os.ReadFile(filepath.Join(dir, "gmail_0.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(b))
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := newOutput(TStatement{Output: "stdout", Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestGenerateFileName(t *testing.T) {
+	assert.Equal(t, filepath.Join("dir", "gmail_3.json"), generateFileName(filepath.Join("dir", "gmail.json"), "3"))
+	assert.Equal(t, "gmail_3", generateFileName("gmail", "3"))
+}
+
+// Test ndjson writes a line per message and appends to an existing file
+func TestExportNdjsonAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	statement := TStatement{Output: path, Format: "ndjson", Area: "small", Append: true}
+
+	_, err := NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+	_, err = NewWithClient(newTestMailbox(t, 1), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(string(b), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "", lines[3])
+	for i, id := range []string{"2", "1", "1"} {
+		var message map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &message))
+		assert.Equal(t, id, message["id"])
+	}
+}
+
+func TestAppendNeedsNdjson(t *testing.T) {
+	_, err := newOutput(TStatement{Output: "out.json", Format: "json", Append: true})
+	assert.Error(t, err)
+	_, err = newOutput(TStatement{Output: "out.ndjson", Format: "ndjson", Append: true, Split: true})
+	assert.ErrorContains(t, err, "split output cannot be appended to")
+}
+
+// Test every split file is encrypted, with the extension of the encryption
+func TestExportEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	identityFile := filepath.Join(dir, "key.txt")
+	require.NoError(t, os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600))
+	statement := TStatement{Output: filepath.Join(dir, "gmail.json"), Split: true, Format: "json", Area: "small", EncryptTo: []string{identity.Recipient().String()}}
+
+	_, err = NewWithClient(newTestMailbox(t, 2), "me", TFilter{}, statement).Export(context.Background())
+	require.NoError(t, err)
+
+	for i, subject := range []string{"Message 2", "Message 1"} {
+		file, err := os.Open(filepath.Join(dir, fmt.Sprintf("gmail_%d.json.age", i)))
+		require.NoError(t, err)
+		plain, err := encryption.Decrypt(file, []string{identityFile})
+		require.NoError(t, err)
+		var message map[string]interface{}
+		require.NoError(t, json.NewDecoder(plain).Decode(&message))
+		assert.Equal(t, subject, message["subject"])
+		file.Close()
+	}
+	_, err = os.Stat(filepath.Join(dir, "gmail_0.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestEncryptedAppend(t *testing.T) {
+	_, err := newOutput(TStatement{Output: "out.ndjson", Format: "ndjson", Append: true, EncryptTo: []string{"age1x"}})
+	assert.EqualError(t, err, "encrypted output cannot be appended to")
+}
@@ -3,65 +3,202 @@ package getclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"golang.org/x/oauth2"
 )
 
+// TokenFile is the file that stores the user's access and refresh tokens. It is
+// created automatically when the authorization flow completes for the first time.
+var TokenFile = "token.json"
+
+// RevokeURL is the Google endpoint used to revoke tokens.
+var RevokeURL = "https://oauth2.googleapis.com/revoke"
+
+// ErrNoToken is returned when there is no saved token.
+var ErrNoToken = errors.New("no saved token, run \"auth login\" first")
+
+// TError is an error of a step of the authorization: reading the authorization code,
+// exchanging it for a token or saving the token.
+type TError struct {
+	Step string
+	Err  error
+}
+
+func (e *TError) Error() string {
+	return fmt.Sprintf("getclient: %s: %v", e.Step, e.Err)
+}
+
+func (e *TError) Unwrap() error {
+	return e.Err
+}
+
+// tStoredToken is the content of the token file: the token itself and the scopes it was granted for.
+type tStoredToken struct {
+	oauth2.Token
+	Scopes []string `json:"scopes,omitempty"`
+}
+
 // Retrieve a token, saves the token, then returns the generated client.
-func GetClient(config *oauth2.Config) *http.Client {
-	// The file token.json stores the user's access and refresh tokens, and is
-	// created automatically when the authorization flow completes for the first
-	// time.
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
+// If the saved token was granted for other scopes than the config requests,
+// the user is asked for consent again.
+func GetClient(config *oauth2.Config) (*http.Client, error) {
+	tok, err := tokenFromFile(TokenFile)
+	if err != nil || !tok.covers(config.Scopes) {
+		tok, err = getTokenFromWeb(config)
+		if err != nil {
+			return nil, err
+		}
+		err = saveToken(TokenFile, tok)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config.Client(context.Background(), &tok.Token), nil
+}
+
+// Login requests a new token from the web and saves it, replacing any saved token.
+func Login(config *oauth2.Config) error {
+	tok, err := getTokenFromWeb(config)
+	if err != nil {
+		return err
+	}
+	return saveToken(TokenFile, tok)
+}
+
+// Token returns the saved token and the scopes it was granted for.
+func Token() (*oauth2.Token, []string, error) {
+	tok, err := tokenFromFile(TokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tok.Token, tok.Scopes, nil
+}
+
+// Logout revokes the saved token at Google and deletes the token file.
+func Logout(ctx context.Context) error {
+	tok, err := tokenFromFile(TokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoToken
+	}
 	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		return err
+	}
+	// Revoking the refresh token also revokes the access tokens issued for it.
+	value := tok.RefreshToken
+	if value == "" {
+		value = tok.AccessToken
+	}
+	if err := revokeToken(ctx, value); err != nil {
+		return err
+	}
+	return os.Remove(TokenFile)
+}
+
+// revokeToken asks Google to revoke the token.
+func revokeToken(ctx context.Context, value string) error {
+	form := url.Values{"token": {value}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, RevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Google answers 400 invalid_token for a token that is already revoked or expired,
+	// which leaves nothing to revoke.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("unable to revoke token: %s", resp.Status)
 	}
-	return config.Client(context.Background(), tok)
+	return nil
 }
 
 // Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
+func getTokenFromWeb(config *oauth2.Config) (*tStoredToken, error) {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	fmt.Printf("Go to the following link in your browser then type the "+
 		"authorization code: \n%v\n", authURL)
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+		return nil, &TError{Step: "read authorization code", Err: err}
 	}
 
 	tok, err := config.Exchange(context.TODO(), authCode)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return nil, &TError{Step: "retrieve token from web", Err: err}
 	}
-	return tok
+	return &tStoredToken{Token: *tok, Scopes: grantedScopes(tok, config.Scopes)}, nil
+}
+
+// grantedScopes returns the scopes reported by the token endpoint, or the requested ones if none were reported.
+func grantedScopes(tok *oauth2.Token, requested []string) []string {
+	if scope, ok := tok.Extra("scope").(string); ok && scope != "" {
+		return strings.Fields(scope)
+	}
+	return requested
+}
+
+// covers reports whether the token was granted all the scopes.
+// Tokens saved without scopes are trusted as is.
+func (tok *tStoredToken) covers(scopes []string) bool {
+	if len(tok.Scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		found := false
+		for _, granted := range tok.Scopes {
+			if granted == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 // Retrieves a token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
+func tokenFromFile(file string) (*tStoredToken, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	tok := &oauth2.Token{}
+	tok := &tStoredToken{}
 	err = json.NewDecoder(f).Decode(tok)
 	return tok, err
 }
 
 // Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
+func saveToken(path string, token *tStoredToken) error {
+	slog.Info("saving credential file", "path", path)
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return &TError{Step: "cache oauth token", Err: err}
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	err = json.NewEncoder(f).Encode(token)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return &TError{Step: "cache oauth token", Err: err}
+	}
+	return nil
 }
@@ -0,0 +1,63 @@
+package getclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestCovers(t *testing.T) {
+	tok := &tStoredToken{Scopes: []string{"a", "b"}}
+	assert.True(t, tok.covers([]string{"a"}))
+	assert.True(t, tok.covers([]string{"b", "a"}))
+	assert.False(t, tok.covers([]string{"a", "c"}))
+
+	// Tokens saved by earlier versions carry no scopes
+	legacy := &tStoredToken{}
+	assert.True(t, legacy.covers([]string{"c"}))
+}
+
+func TestGrantedScopes(t *testing.T) {
+	tok := (&oauth2.Token{}).WithExtra(map[string]interface{}{"scope": "a b"})
+	assert.Equal(t, []string{"a", "b"}, grantedScopes(tok, []string{"c"}))
+	assert.Equal(t, []string{"c"}, grantedScopes(&oauth2.Token{}, []string{"c"}))
+}
+
+func TestTokenFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	require.NoError(t, saveToken(path, &tStoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}, Scopes: []string{"a"}}))
+
+	tok, err := tokenFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "access", tok.AccessToken)
+	assert.Equal(t, "refresh", tok.RefreshToken)
+	assert.Equal(t, []string{"a"}, tok.Scopes)
+}
+
+func TestLogout(t *testing.T) {
+	var revoked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked = r.FormValue("token")
+	}))
+	defer server.Close()
+
+	oldTokenFile, oldRevokeURL := TokenFile, RevokeURL
+	defer func() { TokenFile, RevokeURL = oldTokenFile, oldRevokeURL }()
+	TokenFile = filepath.Join(t.TempDir(), "token.json")
+	RevokeURL = server.URL
+
+	assert.ErrorIs(t, Logout(context.Background()), ErrNoToken)
+
+	require.NoError(t, saveToken(TokenFile, &tStoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}}))
+	require.NoError(t, Logout(context.Background()))
+	assert.Equal(t, "refresh", revoked)
+	_, err := os.Stat(TokenFile)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,534 @@
+// Package fake implements gmailapi.IClient with an in-memory mailbox, so that the
+// whole export can be run and tested without network.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gmailexport/app/gmailapi"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultPageSize is the number of items in a page of a list response, as in Gmail.
+const DefaultPageSize = 100
+
+// systemLabels are the labels every mailbox has
+var systemLabels = []string{"INBOX", "SENT", "DRAFT", "SPAM", "TRASH", "UNREAD", "STARRED", "IMPORTANT",
+	"CATEGORY_PERSONAL", "CATEGORY_SOCIAL", "CATEGORY_PROMOTIONS", "CATEGORY_UPDATES", "CATEGORY_FORUMS"}
+
+// Mailbox is an in-memory Gmail mailbox. It is safe for concurrent use.
+type Mailbox struct {
+	// Address is the email address of the mailbox owner.
+	Address string
+	// PageSize is the number of items in a page of a list response.
+	PageSize int
+
+	mu          sync.Mutex
+	messages    []*gmail.Message
+	attachments map[string]map[string]string
+	labels      []*gmail.Label
+	history     []*gmail.History
+	historyId   uint64
+	lastMessage int
+	lastLabel   int
+	failures    []*tFailure
+	calls       map[string]int
+}
+
+// tFailure is an error injected into the calls of a method
+type tFailure struct {
+	method string
+	id     string
+	times  int
+	err    error
+}
+
+var _ gmailapi.IClient = (*Mailbox)(nil)
+
+// New returns an empty mailbox with the system labels
+func New() *Mailbox {
+	m := &Mailbox{
+		Address:     "me@example.com",
+		PageSize:    DefaultPageSize,
+		attachments: make(map[string]map[string]string),
+		calls:       make(map[string]int),
+	}
+	for _, id := range systemLabels {
+		m.labels = append(m.labels, &gmail.Label{Id: id, Name: id, Type: "system"})
+	}
+	return m
+}
+
+// AddLabel adds a user label. A missing Id is generated, a missing Type is "user".
+// Returns the ID of the label.
+func (m *Mailbox) AddLabel(label *gmail.Label) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := clone(label)
+	if l.Id == "" {
+		m.lastLabel++
+		l.Id = fmt.Sprintf("Label_%d", m.lastLabel)
+	}
+	if l.Type == "" {
+		l.Type = "user"
+	}
+	m.labels = append(m.labels, l)
+	return l.Id
+}
+
+// AddMessage adds a message, for example one returned by ParseMessage. A missing Id is generated.
+// A missing ThreadId is taken from the message it replies to (by the In-Reply-To and References headers),
+// or is the message Id. The data of the parts with an AttachmentId is served by GetAttachment.
+// Returns the ID of the message.
+func (m *Mailbox) AddMessage(message *gmail.Message) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg := clone(message)
+	if msg.Id == "" {
+		m.lastMessage++
+		msg.Id = fmt.Sprintf("%016x", m.lastMessage)
+	}
+	if msg.ThreadId == "" {
+		msg.ThreadId = m.threadOf(msg)
+	}
+	if msg.Payload != nil {
+		m.attachments[msg.Id] = make(map[string]string)
+		extractAttachments(msg.Payload, m.attachments[msg.Id])
+	}
+	m.historyId++
+	msg.HistoryId = m.historyId
+	m.messages = append(m.messages, msg)
+	m.history = append(m.history, &gmail.History{
+		Id:            m.historyId,
+		Messages:      []*gmail.Message{{Id: msg.Id, ThreadId: msg.ThreadId}},
+		MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId, LabelIds: msg.LabelIds}}},
+	})
+	return msg.Id
+}
+
+// DeleteMessage removes a message and records it in the history
+func (m *Mailbox) DeleteMessage(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, msg := range m.messages {
+		if msg.Id == id {
+			m.messages = append(m.messages[:i], m.messages[i+1:]...)
+			m.historyId++
+			m.history = append(m.history, &gmail.History{
+				Id:              m.historyId,
+				Messages:        []*gmail.Message{{Id: msg.Id, ThreadId: msg.ThreadId}},
+				MessagesDeleted: []*gmail.HistoryMessageDeleted{{Message: &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId}}},
+			})
+			return
+		}
+	}
+}
+
+// ModifyLabels adds and removes labels of a message and records it in the history
+func (m *Mailbox) ModifyLabels(id string, add, remove []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg := m.message(id)
+	if msg == nil {
+		return
+	}
+	labelIds := make([]string, 0, len(msg.LabelIds)+len(add))
+	for _, l := range msg.LabelIds {
+		if !contains(remove, l) && !contains(add, l) {
+			labelIds = append(labelIds, l)
+		}
+	}
+	msg.LabelIds = append(labelIds, add...)
+	m.historyId++
+	msg.HistoryId = m.historyId
+	h := &gmail.History{Id: m.historyId, Messages: []*gmail.Message{{Id: msg.Id, ThreadId: msg.ThreadId}}}
+	if len(add) > 0 {
+		h.LabelsAdded = []*gmail.HistoryLabelAdded{{LabelIds: add, Message: &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId, LabelIds: msg.LabelIds}}}
+	}
+	if len(remove) > 0 {
+		h.LabelsRemoved = []*gmail.HistoryLabelRemoved{{LabelIds: remove, Message: &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId, LabelIds: msg.LabelIds}}}
+	}
+	m.history = append(m.history, h)
+}
+
+// FailOn makes the calls of the method (an IClient method name, such as "GetMessage") for the id return err.
+// An empty id matches all calls of the method; for list methods the id is the page token.
+// The failure is removed after the given number of calls, or stays if times is 0.
+func (m *Mailbox) FailOn(method, id string, times int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, &tFailure{method: method, id: id, times: times, err: err})
+}
+
+// Calls returns the number of calls of the method (an IClient method name)
+func (m *Mailbox) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+// call counts the call and returns the injected error, if any. m.mu must be held.
+func (m *Mailbox) call(ctx context.Context, method, id string) error {
+	m.calls[method]++
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i, f := range m.failures {
+		if f.method != method || (f.id != "" && f.id != id) {
+			continue
+		}
+		if f.times > 0 {
+			f.times--
+			if f.times == 0 {
+				m.failures = append(m.failures[:i], m.failures[i+1:]...)
+			}
+		}
+		return f.err
+	}
+	return nil
+}
+
+// ListMessages returns a page of the messages that match q, newest first
+func (m *Mailbox) ListMessages(ctx context.Context, user, q, pageToken string) (*gmail.ListMessagesResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "ListMessages", pageToken); err != nil {
+		return nil, err
+	}
+	query, err := ParseQuery(q)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	var found []*gmail.Message
+	for _, msg := range m.sorted() {
+		if query.Match(msg, m.labels) {
+			found = append(found, &gmail.Message{Id: msg.Id, ThreadId: msg.ThreadId})
+		}
+	}
+	start, end, next, err := m.page(pageToken, len(found))
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.ListMessagesResponse{
+		Messages:           found[start:end],
+		NextPageToken:      next,
+		ResultSizeEstimate: int64(len(found)),
+	}, nil
+}
+
+// GetMessage returns a message in the format "full" (the default), "metadata", "minimal" or "raw"
+func (m *Mailbox) GetMessage(ctx context.Context, user, id, format string) (*gmail.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "GetMessage", id); err != nil {
+		return nil, err
+	}
+	msg := m.message(id)
+	if msg == nil {
+		return nil, notFound("Requested entity was not found.")
+	}
+	return inFormat(msg, format)
+}
+
+// GetAttachment returns the body of an attachment of a message
+func (m *Mailbox) GetAttachment(ctx context.Context, user, messageId, id string) (*gmail.MessagePartBody, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "GetAttachment", id); err != nil {
+		return nil, err
+	}
+	data, ok := m.attachments[messageId][id]
+	if !ok {
+		return nil, notFound("Requested entity was not found.")
+	}
+	return &gmail.MessagePartBody{AttachmentId: id, Data: data, Size: int64(decodedLen(data))}, nil
+}
+
+// ListThreads returns a page of the threads that have messages matching q, most recently updated first
+func (m *Mailbox) ListThreads(ctx context.Context, user, q, pageToken string) (*gmail.ListThreadsResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "ListThreads", pageToken); err != nil {
+		return nil, err
+	}
+	query, err := ParseQuery(q)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	var found []*gmail.Thread
+	seen := make(map[string]bool)
+	for _, msg := range m.sorted() {
+		if seen[msg.ThreadId] || !query.Match(msg, m.labels) {
+			continue
+		}
+		seen[msg.ThreadId] = true
+		found = append(found, &gmail.Thread{Id: msg.ThreadId, Snippet: msg.Snippet, HistoryId: m.threadHistoryId(msg.ThreadId)})
+	}
+	start, end, next, err := m.page(pageToken, len(found))
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.ListThreadsResponse{
+		Threads:            found[start:end],
+		NextPageToken:      next,
+		ResultSizeEstimate: int64(len(found)),
+	}, nil
+}
+
+// GetThread returns a thread with its messages, oldest first, in the format "full" (the default), "metadata" or "minimal"
+func (m *Mailbox) GetThread(ctx context.Context, user, id, format string) (*gmail.Thread, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "GetThread", id); err != nil {
+		return nil, err
+	}
+	if format == "raw" {
+		return nil, badRequest("Invalid format: raw")
+	}
+	thread := &gmail.Thread{Id: id, HistoryId: m.threadHistoryId(id)}
+	sorted := m.sorted()
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if sorted[i].ThreadId != id {
+			continue
+		}
+		msg, err := inFormat(sorted[i], format)
+		if err != nil {
+			return nil, err
+		}
+		thread.Messages = append(thread.Messages, msg)
+		thread.Snippet = msg.Snippet
+	}
+	if len(thread.Messages) == 0 {
+		return nil, notFound("Requested entity was not found.")
+	}
+	return thread, nil
+}
+
+// ListLabels returns all labels of the mailbox, without counts as Gmail does
+func (m *Mailbox) ListLabels(ctx context.Context, user string) (*gmail.ListLabelsResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "ListLabels", ""); err != nil {
+		return nil, err
+	}
+	resp := &gmail.ListLabelsResponse{}
+	for _, l := range m.labels {
+		resp.Labels = append(resp.Labels, clone(l))
+	}
+	return resp, nil
+}
+
+// GetLabel returns a label with its message and thread counts
+func (m *Mailbox) GetLabel(ctx context.Context, user, id string) (*gmail.Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "GetLabel", id); err != nil {
+		return nil, err
+	}
+	for _, l := range m.labels {
+		if l.Id != id {
+			continue
+		}
+		label := clone(l)
+		threads := make(map[string]bool)
+		unreadThreads := make(map[string]bool)
+		for _, msg := range m.messages {
+			if !contains(msg.LabelIds, id) {
+				continue
+			}
+			label.MessagesTotal++
+			threads[msg.ThreadId] = true
+			if contains(msg.LabelIds, "UNREAD") {
+				label.MessagesUnread++
+				unreadThreads[msg.ThreadId] = true
+			}
+		}
+		label.ThreadsTotal = int64(len(threads))
+		label.ThreadsUnread = int64(len(unreadThreads))
+		return label, nil
+	}
+	return nil, notFound("Requested entity was not found.")
+}
+
+// ListHistory returns a page of the changes to the mailbox after startHistoryId, oldest first
+func (m *Mailbox) ListHistory(ctx context.Context, user string, startHistoryId uint64, pageToken string) (*gmail.ListHistoryResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "ListHistory", pageToken); err != nil {
+		return nil, err
+	}
+	var found []*gmail.History
+	for _, h := range m.history {
+		if h.Id > startHistoryId {
+			found = append(found, clone(h))
+		}
+	}
+	start, end, next, err := m.page(pageToken, len(found))
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.ListHistoryResponse{History: found[start:end], NextPageToken: next, HistoryId: m.historyId}, nil
+}
+
+// GetProfile returns the address and counters of the mailbox
+func (m *Mailbox) GetProfile(ctx context.Context, user string) (*gmail.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call(ctx, "GetProfile", ""); err != nil {
+		return nil, err
+	}
+	threads := make(map[string]bool)
+	for _, msg := range m.messages {
+		threads[msg.ThreadId] = true
+	}
+	return &gmail.Profile{
+		EmailAddress:  m.Address,
+		MessagesTotal: int64(len(m.messages)),
+		ThreadsTotal:  int64(len(threads)),
+		HistoryId:     m.historyId,
+	}, nil
+}
+
+// message returns the stored message with the id, or nil. m.mu must be held.
+func (m *Mailbox) message(id string) *gmail.Message {
+	for _, msg := range m.messages {
+		if msg.Id == id {
+			return msg
+		}
+	}
+	return nil
+}
+
+// sorted returns the messages newest first. m.mu must be held.
+func (m *Mailbox) sorted() []*gmail.Message {
+	sorted := make([]*gmail.Message, len(m.messages))
+	copy(sorted, m.messages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].InternalDate > sorted[j].InternalDate
+	})
+	return sorted
+}
+
+// threadHistoryId returns the last history ID of the messages of a thread. m.mu must be held.
+func (m *Mailbox) threadHistoryId(threadId string) uint64 {
+	var id uint64
+	for _, msg := range m.messages {
+		if msg.ThreadId == threadId && msg.HistoryId > id {
+			id = msg.HistoryId
+		}
+	}
+	return id
+}
+
+// threadOf returns the thread of the message the msg replies to, or the msg Id. m.mu must be held.
+func (m *Mailbox) threadOf(msg *gmail.Message) string {
+	refs := strings.Fields(header(msg, "References") + " " + header(msg, "In-Reply-To"))
+	for _, ref := range refs {
+		for _, other := range m.messages {
+			if header(other, "Message-ID") == ref {
+				return other.ThreadId
+			}
+		}
+	}
+	return msg.Id
+}
+
+// page returns the bounds of the page for the token and the token of the next page. m.mu must be held.
+func (m *Mailbox) page(pageToken string, total int) (start, end int, next string, err error) {
+	if pageToken != "" {
+		start, err = strconv.Atoi(pageToken)
+		if err != nil || start < 0 || start > total {
+			return 0, 0, "", badRequest("Invalid pageToken")
+		}
+	}
+	size := m.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	end = start + size
+	if end >= total {
+		return start, total, "", nil
+	}
+	return start, end, strconv.Itoa(end), nil
+}
+
+// inFormat returns a copy of the message with the fields returned by Gmail for the format
+func inFormat(msg *gmail.Message, format string) (*gmail.Message, error) {
+	out := clone(msg)
+	switch format {
+	case "", "full":
+		out.Raw = ""
+	case "metadata":
+		out.Raw = ""
+		if out.Payload != nil {
+			out.Payload = &gmail.MessagePart{MimeType: out.Payload.MimeType, Headers: out.Payload.Headers}
+		}
+	case "minimal":
+		out.Raw = ""
+		out.Payload = nil
+	case "raw":
+		out.Payload = nil
+	default:
+		return nil, badRequest("Invalid format: " + format)
+	}
+	return out, nil
+}
+
+// extractAttachments moves the data of the parts with an AttachmentId to attachments
+func extractAttachments(part *gmail.MessagePart, attachments map[string]string) {
+	if part.Body != nil && part.Body.AttachmentId != "" {
+		attachments[part.Body.AttachmentId] = part.Body.Data
+		part.Body.Data = ""
+	}
+	for _, p := range part.Parts {
+		extractAttachments(p, attachments)
+	}
+}
+
+// header returns the value of the first header of the message with the name
+func header(msg *gmail.Message, name string) string {
+	if msg.Payload == nil {
+		return ""
+	}
+	return headerValue(msg.Payload.Headers, name)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a deep copy of a Gmail API value
+func clone[T any](v *T) *T {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	out := new(T)
+	if err := json.Unmarshal(b, out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// notFound returns the error Gmail returns for a missing entity
+func notFound(message string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: message}
+}
+
+// badRequest returns the error Gmail returns for an invalid request
+func badRequest(message string) error {
+	return &googleapi.Error{Code: http.StatusBadRequest, Message: message}
+}
@@ -0,0 +1,231 @@
+package fake
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const testRaw = "From: sender@example.com\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"Date: Mon, 3 May 2021 10:00:00 +0000\r\n" +
+	"Message-ID: <first@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Hello, world!\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment; filename=\"data.bin\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"AAEC\r\n" +
+	"--b1--\r\n"
+
+const testReply = "From: me@example.com\r\n" +
+	"To: sender@example.com\r\n" +
+	"Subject: Re: Hello\r\n" +
+	"Date: Tue, 4 May 2021 10:00:00 +0000\r\n" +
+	"Message-ID: <second@example.com>\r\n" +
+	"In-Reply-To: <first@example.com>\r\n" +
+	"\r\n" +
+	"Hi!\r\n"
+
+// newTestMailbox returns a mailbox with a message and a reply to it
+func newTestMailbox(t *testing.T) (*Mailbox, string, string) {
+	m := New()
+	first, err := ParseMessage([]byte(testRaw))
+	require.NoError(t, err)
+	reply, err := ParseMessage([]byte(testReply))
+	require.NoError(t, err)
+	reply.LabelIds = []string{"SENT", "UNREAD"}
+	return m, m.AddMessage(first), m.AddMessage(reply)
+}
+
+func TestListMessages(t *testing.T) {
+	m, first, reply := newTestMailbox(t)
+	ctx := context.Background()
+
+	resp, err := m.ListMessages(ctx, "me", "", "")
+	require.NoError(t, err)
+	require.Len(t, resp.Messages, 2)
+	// Newest first
+	assert.Equal(t, reply, resp.Messages[0].Id)
+	assert.Equal(t, first, resp.Messages[1].Id)
+	assert.Equal(t, int64(2), resp.ResultSizeEstimate)
+
+	resp, err = m.ListMessages(ctx, "me", "subject:hello -label:sent", "")
+	require.NoError(t, err)
+	require.Len(t, resp.Messages, 1)
+	assert.Equal(t, first, resp.Messages[0].Id)
+}
+
+func TestListMessagesPages(t *testing.T) {
+	m, first, reply := newTestMailbox(t)
+	m.PageSize = 1
+	ctx := context.Background()
+
+	resp, err := m.ListMessages(ctx, "me", "", "")
+	require.NoError(t, err)
+	require.Len(t, resp.Messages, 1)
+	assert.Equal(t, reply, resp.Messages[0].Id)
+	require.NotEmpty(t, resp.NextPageToken)
+
+	resp, err = m.ListMessages(ctx, "me", "", resp.NextPageToken)
+	require.NoError(t, err)
+	require.Len(t, resp.Messages, 1)
+	assert.Equal(t, first, resp.Messages[0].Id)
+	assert.Empty(t, resp.NextPageToken)
+
+	_, err = m.ListMessages(ctx, "me", "", "bad")
+	assert.Error(t, err)
+}
+
+func TestGetMessageFormats(t *testing.T) {
+	m, first, _ := newTestMailbox(t)
+	ctx := context.Background()
+
+	full, err := m.GetMessage(ctx, "me", first, "full")
+	require.NoError(t, err)
+	assert.Empty(t, full.Raw)
+	require.Len(t, full.Payload.Parts, 2)
+
+	raw, err := m.GetMessage(ctx, "me", first, "raw")
+	require.NoError(t, err)
+	assert.Nil(t, raw.Payload)
+	b, err := base64.URLEncoding.DecodeString(raw.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, testRaw, string(b))
+
+	metadata, err := m.GetMessage(ctx, "me", first, "metadata")
+	require.NoError(t, err)
+	assert.NotEmpty(t, metadata.Payload.Headers)
+	assert.Empty(t, metadata.Payload.Parts)
+
+	minimal, err := m.GetMessage(ctx, "me", first, "minimal")
+	require.NoError(t, err)
+	assert.Nil(t, minimal.Payload)
+
+	_, err = m.GetMessage(ctx, "me", "missing", "full")
+	var apiErr *googleapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 404, apiErr.Code)
+}
+
+func TestGetAttachment(t *testing.T) {
+	m, first, _ := newTestMailbox(t)
+	ctx := context.Background()
+
+	full, err := m.GetMessage(ctx, "me", first, "full")
+	require.NoError(t, err)
+	part := full.Payload.Parts[1]
+	assert.Equal(t, "data.bin", part.Filename)
+	// As in Gmail, the data of an attachment is not a part of the message
+	assert.Empty(t, part.Body.Data)
+
+	body, err := m.GetAttachment(ctx, "me", first, part.Body.AttachmentId)
+	require.NoError(t, err)
+	b, err := base64.URLEncoding.DecodeString(body.Data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, b)
+	assert.Equal(t, int64(3), body.Size)
+}
+
+func TestThreads(t *testing.T) {
+	m, first, reply := newTestMailbox(t)
+	ctx := context.Background()
+
+	resp, err := m.ListThreads(ctx, "me", "", "")
+	require.NoError(t, err)
+	// The reply is in the thread of the message it replies to
+	require.Len(t, resp.Threads, 1)
+	assert.Equal(t, first, resp.Threads[0].Id)
+
+	thread, err := m.GetThread(ctx, "me", first, "full")
+	require.NoError(t, err)
+	require.Len(t, thread.Messages, 2)
+	// Oldest first
+	assert.Equal(t, first, thread.Messages[0].Id)
+	assert.Equal(t, reply, thread.Messages[1].Id)
+}
+
+func TestLabels(t *testing.T) {
+	m, first, _ := newTestMailbox(t)
+	ctx := context.Background()
+	id := m.AddLabel(&gmail.Label{Name: "Work/Clients", Color: &gmail.LabelColor{BackgroundColor: "#000000", TextColor: "#ffffff"}})
+	m.ModifyLabels(first, []string{id}, nil)
+	// Labels and messages are numbered separately
+	assert.Equal(t, "Label_1", id)
+
+	resp, err := m.ListLabels(ctx, "me")
+	require.NoError(t, err)
+	assert.Equal(t, "Work/Clients", resp.Labels[len(resp.Labels)-1].Name)
+	assert.Equal(t, int64(0), resp.Labels[len(resp.Labels)-1].MessagesTotal)
+
+	label, err := m.GetLabel(ctx, "me", id)
+	require.NoError(t, err)
+	assert.Equal(t, "user", label.Type)
+	assert.Equal(t, int64(1), label.MessagesTotal)
+	assert.Equal(t, int64(1), label.ThreadsTotal)
+	assert.Equal(t, "#000000", label.Color.BackgroundColor)
+
+	unread, err := m.GetLabel(ctx, "me", "UNREAD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), unread.MessagesUnread)
+
+	list, err := m.ListMessages(ctx, "me", "label:work-clients", "")
+	require.NoError(t, err)
+	require.Len(t, list.Messages, 1)
+	assert.Equal(t, first, list.Messages[0].Id)
+}
+
+func TestHistory(t *testing.T) {
+	m, first, reply := newTestMailbox(t)
+	ctx := context.Background()
+	profile, err := m.GetProfile(ctx, "me")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), profile.MessagesTotal)
+	assert.Equal(t, int64(1), profile.ThreadsTotal)
+
+	m.ModifyLabels(first, []string{"STARRED"}, []string{"INBOX"})
+	m.DeleteMessage(reply)
+
+	resp, err := m.ListHistory(ctx, "me", profile.HistoryId, "")
+	require.NoError(t, err)
+	require.Len(t, resp.History, 2)
+	assert.Equal(t, []string{"STARRED"}, resp.History[0].LabelsAdded[0].LabelIds)
+	assert.Equal(t, []string{"INBOX"}, resp.History[0].LabelsRemoved[0].LabelIds)
+	assert.Equal(t, reply, resp.History[1].MessagesDeleted[0].Message.Id)
+	assert.Equal(t, resp.History[1].Id, resp.HistoryId)
+}
+
+func TestFailOn(t *testing.T) {
+	m, first, reply := newTestMailbox(t)
+	ctx := context.Background()
+	failure := errors.New("backend error")
+	m.FailOn("GetMessage", first, 1, failure)
+
+	_, err := m.GetMessage(ctx, "me", reply, "full")
+	assert.NoError(t, err)
+	_, err = m.GetMessage(ctx, "me", first, "full")
+	assert.ErrorIs(t, err, failure)
+	// The failure was injected once
+	_, err = m.GetMessage(ctx, "me", first, "full")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, m.Calls("GetMessage"))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.GetMessage(cancelled, "me", first, "full")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,196 @@
+package fake
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// snippetLength is the maximum length of a message snippet
+const snippetLength = 200
+
+// ParseMessage builds a Gmail message from an RFC 2822 message, as Gmail does for a received one:
+// the payload with the MIME parts and decoded headers, the raw message, snippet, size and internal date.
+// Parts with a file name get an AttachmentId. The Id and ThreadId are left empty.
+func ParseMessage(raw []byte) (*gmail.Message, error) {
+	payload, err := parsePart(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	msg := &gmail.Message{
+		Payload:      payload,
+		Raw:          base64.URLEncoding.EncodeToString(raw),
+		SizeEstimate: int64(len(raw)),
+		Snippet:      snippet(plainText(payload)),
+		LabelIds:     []string{"INBOX"},
+	}
+	if date, err := mail.ParseDate(header(msg, "Date")); err == nil {
+		msg.InternalDate = date.UnixMilli()
+	}
+	return msg, nil
+}
+
+// parsePart parses a MIME entity: headers and a body, which may have parts of its own
+func parsePart(raw []byte, partId string) (*gmail.MessagePart, error) {
+	headers, body, err := splitHeaders(raw)
+	if err != nil {
+		return nil, err
+	}
+	part := &gmail.MessagePart{PartId: partId, Headers: headers, Body: &gmail.MessagePartBody{}}
+	contentType := headerValue(headers, "Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	part.MimeType = mediaType
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		for i, entity := range splitMultipart(body, params["boundary"]) {
+			subId := strconv.Itoa(i)
+			if partId != "" {
+				subId = partId + "." + subId
+			}
+			sub, err := parsePart(entity, subId)
+			if err != nil {
+				return nil, err
+			}
+			part.Parts = append(part.Parts, sub)
+		}
+		return part, nil
+	}
+
+	data, err := decodeBody(body, headerValue(headers, "Content-Transfer-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	part.Body.Data = base64.URLEncoding.EncodeToString(data)
+	part.Body.Size = int64(len(data))
+	if _, dispositionParams, err := mime.ParseMediaType(headerValue(headers, "Content-Disposition")); err == nil {
+		part.Filename = dispositionParams["filename"]
+	}
+	if part.Filename == "" {
+		part.Filename = params["name"]
+	}
+	if part.Filename != "" {
+		part.Body.AttachmentId = "ATT" + strings.ReplaceAll(partId, ".", "_")
+	}
+	return part, nil
+}
+
+// splitMultipart returns the entities of a multipart body, without the preamble and epilogue
+func splitMultipart(body []byte, boundary string) [][]byte {
+	var entities [][]byte
+	delimiter := []byte("\n--" + boundary)
+	segments := bytes.Split(append([]byte("\n"), body...), delimiter)
+	// The first segment is the preamble
+	for _, segment := range segments[1:] {
+		if bytes.HasPrefix(segment, []byte("--")) {
+			break
+		}
+		// Skip the rest of the delimiter line, the line break before the next delimiter belongs to it
+		if i := bytes.IndexByte(segment, '\n'); i >= 0 {
+			segment = segment[i+1:]
+		} else {
+			segment = nil
+		}
+		entities = append(entities, bytes.TrimSuffix(segment, []byte("\r")))
+	}
+	return entities
+}
+
+// splitHeaders returns the unfolded, decoded headers in their order and the body of an entity
+func splitHeaders(raw []byte) ([]*gmail.MessagePartHeader, []byte, error) {
+	var headers []*gmail.MessagePartHeader
+	decoder := new(mime.WordDecoder)
+	reader := bufio.NewReader(bytes.NewReader(raw))
+	offset := 0
+	for {
+		line, err := reader.ReadString('\n')
+		offset += len(line)
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "" {
+			break
+		}
+		if (trimmed[0] == ' ' || trimmed[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(trimmed)
+		} else if i := strings.Index(trimmed, ":"); i > 0 {
+			headers = append(headers, &gmail.MessagePartHeader{Name: trimmed[:i], Value: strings.TrimSpace(trimmed[i+1:])})
+		} else {
+			return nil, nil, fmt.Errorf("malformed header line %q", trimmed)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, h := range headers {
+		if decoded, err := decoder.DecodeHeader(h.Value); err == nil {
+			h.Value = decoded
+		}
+	}
+	if offset > len(raw) {
+		offset = len(raw)
+	}
+	return headers, raw[offset:], nil
+}
+
+// decodeBody decodes a body in the Content-Transfer-Encoding
+func decodeBody(body []byte, encoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		clean := strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, string(body))
+		return base64.StdEncoding.DecodeString(clean)
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+	default:
+		return body, nil
+	}
+}
+
+// headerValue returns the value of the first header with the name
+func headerValue(headers []*gmail.MessagePartHeader, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// snippet returns the beginning of the text with the whitespace collapsed
+func snippet(text string) string {
+	s := strings.Join(strings.Fields(text), " ")
+	runes := []rune(s)
+	if len(runes) > snippetLength {
+		return string(runes[:snippetLength])
+	}
+	return s
+}
+
+// decodedLen returns the length of base64url data after decoding
+func decodedLen(data string) int {
+	b, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
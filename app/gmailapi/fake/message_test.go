@@ -0,0 +1,59 @@
+package fake
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg, err := ParseMessage([]byte(testRaw))
+	require.NoError(t, err)
+
+	assert.Equal(t, "multipart/mixed", msg.Payload.MimeType)
+	assert.Equal(t, "From", msg.Payload.Headers[0].Name)
+	assert.Equal(t, "Subject", msg.Payload.Headers[2].Name)
+	assert.Equal(t, "Hello", msg.Payload.Headers[2].Value)
+	assert.Equal(t, int64(1620036000000), msg.InternalDate)
+	assert.Equal(t, int64(len(testRaw)), msg.SizeEstimate)
+	assert.Equal(t, "Hello, world!", msg.Snippet)
+
+	require.Len(t, msg.Payload.Parts, 2)
+	text := msg.Payload.Parts[0]
+	assert.Equal(t, "0", text.PartId)
+	assert.Equal(t, "text/plain", text.MimeType)
+	b, err := base64.URLEncoding.DecodeString(text.Body.Data)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, world!", string(b))
+
+	attachment := msg.Payload.Parts[1]
+	assert.Equal(t, "1", attachment.PartId)
+	assert.Equal(t, "data.bin", attachment.Filename)
+	assert.NotEmpty(t, attachment.Body.AttachmentId)
+	assert.Equal(t, int64(3), attachment.Body.Size)
+}
+
+func TestParseMessageEncodings(t *testing.T) {
+	raw := "Subject: =?UTF-8?B?0J/RgNC40LLRltGC?=\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"X-Folded: first\r\n" +
+		" second\r\n" +
+		"\r\n" +
+		"caf=C3=A9\r\n"
+	msg, err := ParseMessage([]byte(raw))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Привіт", msg.Payload.Headers[0].Value)
+	assert.Equal(t, "first second", msg.Payload.Headers[3].Value)
+	b, err := base64.URLEncoding.DecodeString(msg.Payload.Body.Data)
+	require.NoError(t, err)
+	assert.Equal(t, "café\r\n", string(b))
+}
+
+func TestParseMessageMalformed(t *testing.T) {
+	_, err := ParseMessage([]byte("not a header\r\n\r\nbody"))
+	assert.Error(t, err)
+}
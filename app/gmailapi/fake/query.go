@@ -0,0 +1,201 @@
+package fake
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// TQuery is a parsed Gmail search query.
+// It supports the subset of the Gmail search operators used by the tool:
+// from:, to:, cc:, subject:, label:, in:, is:, has:attachment, rfc822msgid:,
+// after:, before:, words, "phrases", negation with - and OR between terms.
+// Terms are combined with AND, which may also be written explicitly.
+type TQuery struct {
+	// groups are joined with AND, the terms of a group with OR
+	groups [][]tTerm
+}
+
+// tTerm is a single condition of a query
+type tTerm struct {
+	operator string
+	value    string
+	negated  bool
+}
+
+// ParseQuery parses a Gmail search query. An empty query matches all messages.
+func ParseQuery(q string) (TQuery, error) {
+	var query TQuery
+	or := false
+	for _, token := range tokenize(q) {
+		switch token {
+		case "AND":
+			continue
+		case "OR":
+			if len(query.groups) == 0 {
+				return query, fmt.Errorf("invalid query: OR without a term before it")
+			}
+			or = true
+			continue
+		}
+		term := tTerm{value: token}
+		if strings.HasPrefix(term.value, "-") && len(term.value) > 1 {
+			term.negated = true
+			term.value = term.value[1:]
+		}
+		if i := strings.Index(term.value, ":"); i > 0 {
+			operator := strings.ToLower(term.value[:i])
+			switch operator {
+			case "from", "to", "cc", "subject", "label", "in", "is", "has", "rfc822msgid", "after", "before":
+				term.operator = operator
+				term.value = term.value[i+1:]
+			}
+		}
+		term.value = strings.Trim(term.value, `"`)
+		if term.operator == "after" || term.operator == "before" {
+			if _, err := parseDate(term.value); err != nil {
+				return query, fmt.Errorf("invalid query: %v", err)
+			}
+		}
+		if or {
+			last := len(query.groups) - 1
+			query.groups[last] = append(query.groups[last], term)
+			or = false
+		} else {
+			query.groups = append(query.groups, []tTerm{term})
+		}
+	}
+	if or {
+		return query, fmt.Errorf("invalid query: OR without a term after it")
+	}
+	return query, nil
+}
+
+// tokenize splits a query at spaces outside of double quotes
+func tokenize(q string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token.WriteRune(r)
+		case (r == ' ' || r == '\t') && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// Match reports whether the message matches the query. The labels resolve label names used by label:.
+func (query TQuery) Match(msg *gmail.Message, labels []*gmail.Label) bool {
+	for _, group := range query.groups {
+		matched := false
+		for _, term := range group {
+			if term.match(msg, labels) != term.negated {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether the message satisfies the term, ignoring negation
+func (term tTerm) match(msg *gmail.Message, labels []*gmail.Label) bool {
+	value := strings.ToLower(term.value)
+	switch term.operator {
+	case "from", "to", "cc", "subject":
+		return strings.Contains(strings.ToLower(header(msg, term.operator)), value)
+	case "rfc822msgid":
+		return strings.Trim(strings.ToLower(header(msg, "Message-ID")), "<>") == strings.Trim(value, "<>")
+	case "label", "in":
+		for _, id := range msg.LabelIds {
+			if strings.ToLower(id) == value {
+				return true
+			}
+			for _, l := range labels {
+				if l.Id == id && labelQueryName(l.Name) == labelQueryName(value) {
+					return true
+				}
+			}
+		}
+		return false
+	case "is":
+		return contains(msg.LabelIds, strings.ToUpper(value))
+	case "has":
+		return value == "attachment" && msg.Payload != nil && hasAttachment(msg.Payload)
+	case "after", "before":
+		date, _ := parseDate(term.value)
+		internal := time.UnixMilli(msg.InternalDate)
+		if term.operator == "after" {
+			return !internal.Before(date)
+		}
+		return internal.Before(date)
+	default:
+		text := strings.ToLower(strings.Join([]string{header(msg, "Subject"), header(msg, "From"), header(msg, "To"), msg.Snippet, plainText(msg.Payload)}, "\n"))
+		return strings.Contains(text, value)
+	}
+}
+
+// labelQueryName returns the label name as written in queries: lower case, with spaces and slashes as dashes
+func labelQueryName(name string) string {
+	return strings.NewReplacer(" ", "-", "/", "-").Replace(strings.ToLower(name))
+}
+
+// parseDate parses a date of the after: and before: operators
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006/01/02", "2006-01-02", "2006/1/2"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s)
+}
+
+// hasAttachment reports whether the part or its subparts have a file name
+func hasAttachment(part *gmail.MessagePart) bool {
+	if part.Filename != "" {
+		return true
+	}
+	for _, p := range part.Parts {
+		if hasAttachment(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainText returns the decoded first text/plain part
+func plainText(part *gmail.MessagePart) string {
+	if part == nil {
+		return ""
+	}
+	if part.MimeType == "text/plain" && part.Body != nil {
+		b, err := base64.URLEncoding.DecodeString(part.Body.Data)
+		if err == nil {
+			return string(b)
+		}
+	}
+	for _, p := range part.Parts {
+		if text := plainText(p); text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestQueryMatch(t *testing.T) {
+	msg, err := ParseMessage([]byte(testRaw))
+	require.NoError(t, err)
+	msg.LabelIds = []string{"INBOX", "Label_1"}
+	labels := []*gmail.Label{{Id: "Label_1", Name: "My Project"}}
+
+	tests := []struct {
+		q     string
+		match bool
+	}{
+		{"", true},
+		{"from:sender@example.com", true},
+		{"from:other@example.com", false},
+		{"to:me@example.com AND subject:hello", true},
+		{"subject:hello subject:bye", false},
+		{"subject:bye OR subject:hello", true},
+		{"-subject:hello", false},
+		{"label:inbox", true},
+		{"label:my-project", true},
+		{"in:sent", false},
+		{"is:unread", false},
+		{"has:attachment", true},
+		{"rfc822msgid:first@example.com", true},
+		{"after:2021/05/01 before:2021/05/04", true},
+		{"after:2021/05/04", false},
+		{"world", true},
+		{"\"Hello, world\"", true},
+		{"missing", false},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.q)
+		require.NoError(t, err, test.q)
+		assert.Equal(t, test.match, query.Match(msg, labels), test.q)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, q := range []string{"OR subject:a", "subject:a OR", "after:yesterday"} {
+		_, err := ParseQuery(q)
+		assert.Error(t, err, q)
+	}
+}
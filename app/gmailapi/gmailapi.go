@@ -0,0 +1,77 @@
+// Package gmailapi defines the part of the Gmail API used by the tool, so that the
+// real service can be replaced, for example by the in-memory mailbox of package fake.
+package gmailapi
+
+import (
+	"context"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// IClient defines the Gmail API calls used by the tool
+type IClient interface {
+	// ListMessages returns a page of the messages that match the query q.
+	ListMessages(ctx context.Context, user, q, pageToken string) (*gmail.ListMessagesResponse, error)
+	// GetMessage returns a message in the format "full", "metadata", "minimal" or "raw".
+	GetMessage(ctx context.Context, user, id, format string) (*gmail.Message, error)
+	// GetAttachment returns the body of an attachment of a message.
+	GetAttachment(ctx context.Context, user, messageId, id string) (*gmail.MessagePartBody, error)
+	// ListThreads returns a page of the threads that match the query q.
+	ListThreads(ctx context.Context, user, q, pageToken string) (*gmail.ListThreadsResponse, error)
+	// GetThread returns a thread with its messages in the format "full", "metadata" or "minimal".
+	GetThread(ctx context.Context, user, id, format string) (*gmail.Thread, error)
+	// ListLabels returns all labels of the mailbox.
+	ListLabels(ctx context.Context, user string) (*gmail.ListLabelsResponse, error)
+	// GetLabel returns a label with its message and thread counts.
+	GetLabel(ctx context.Context, user, id string) (*gmail.Label, error)
+	// ListHistory returns a page of the changes to the mailbox after startHistoryId.
+	ListHistory(ctx context.Context, user string, startHistoryId uint64, pageToken string) (*gmail.ListHistoryResponse, error)
+	// GetProfile returns the email address and counters of the mailbox.
+	GetProfile(ctx context.Context, user string) (*gmail.Profile, error)
+}
+
+// tService implements IClient with the Gmail service
+type tService struct {
+	srv *gmail.Service
+}
+
+// New returns an IClient that calls the Gmail service
+func New(srv *gmail.Service) IClient {
+	return tService{srv: srv}
+}
+
+func (s tService) ListMessages(ctx context.Context, user, q, pageToken string) (*gmail.ListMessagesResponse, error) {
+	return s.srv.Users.Messages.List(user).Q(q).PageToken(pageToken).Context(ctx).Do()
+}
+
+func (s tService) GetMessage(ctx context.Context, user, id, format string) (*gmail.Message, error) {
+	return s.srv.Users.Messages.Get(user, id).Format(format).Context(ctx).Do()
+}
+
+func (s tService) GetAttachment(ctx context.Context, user, messageId, id string) (*gmail.MessagePartBody, error) {
+	return s.srv.Users.Messages.Attachments.Get(user, messageId, id).Context(ctx).Do()
+}
+
+func (s tService) ListThreads(ctx context.Context, user, q, pageToken string) (*gmail.ListThreadsResponse, error) {
+	return s.srv.Users.Threads.List(user).Q(q).PageToken(pageToken).Context(ctx).Do()
+}
+
+func (s tService) GetThread(ctx context.Context, user, id, format string) (*gmail.Thread, error) {
+	return s.srv.Users.Threads.Get(user, id).Format(format).Context(ctx).Do()
+}
+
+func (s tService) ListLabels(ctx context.Context, user string) (*gmail.ListLabelsResponse, error) {
+	return s.srv.Users.Labels.List(user).Context(ctx).Do()
+}
+
+func (s tService) GetLabel(ctx context.Context, user, id string) (*gmail.Label, error) {
+	return s.srv.Users.Labels.Get(user, id).Context(ctx).Do()
+}
+
+func (s tService) ListHistory(ctx context.Context, user string, startHistoryId uint64, pageToken string) (*gmail.ListHistoryResponse, error) {
+	return s.srv.Users.History.List(user).StartHistoryId(startHistoryId).PageToken(pageToken).Context(ctx).Do()
+}
+
+func (s tService) GetProfile(ctx context.Context, user string) (*gmail.Profile, error) {
+	return s.srv.Users.GetProfile(user).Context(ctx).Do()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"gmailexport/app/exporter"
+	"gmailexport/app/gmailapi"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// tLabelsCmd exports the label catalogue with message and thread counts and colours
+type tLabelsCmd struct {
+	Output string `short:"O" long:"output" default:"stdout" description:"output path: stdout - if missing, else output to file"`
+	Format string `short:"F" long:"format" default:"json" description:"output format"`
+
+	connection *tConnection
+}
+
+func (cmd *tLabelsCmd) Execute(args []string) error {
+	ctx := context.Background()
+	srv, err := newService(ctx, cmd.connection.Endpoint, gmail.GmailReadonlyScope)
+	if err != nil {
+		return err
+	}
+	labels, err := exporter.Labels(ctx, gmailapi.New(srv), user)
+	if err != nil {
+		return err
+	}
+	return exporter.WriteLabels(labels, exporter.TStatement{Output: cmd.Output, Format: cmd.Format})
+}
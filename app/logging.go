@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"gmailexport/app/exporter"
+	"gmailexport/app/getclient"
+	"io"
+	"log/slog"
+)
+
+// tLogOpts represents the options of the log written to stderr
+type tLogOpts struct {
+	LogLevel  string `long:"log-level" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info" description:"the lowest level logged; debug logs every message with its Gmail ID and phase"`
+	LogFormat string `long:"log-format" choice:"text" choice:"json" default:"text" description:"log as key=value text or as JSON lines"`
+}
+
+// newLogger returns the logger of the options, writing to w
+func newLogger(opts tLogOpts, w io.Writer) *slog.Logger {
+	var level slog.Level
+	// The choices of the option are names that UnmarshalText accepts.
+	level.UnmarshalText([]byte(opts.LogLevel))
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if opts.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, handlerOpts))
+	}
+	return slog.New(slog.NewTextHandler(w, handlerOpts))
+}
+
+// logError logs the error that stopped a command, with the phase and the Gmail IDs of an export
+// error or the step of an authorization error as attributes
+func logError(logger *slog.Logger, err error) {
+	var exportErr *exporter.TError
+	var clientErr *getclient.TError
+	switch {
+	case errors.As(err, &exportErr):
+		logger.Error("export failed", "error", exportErr)
+	case errors.As(err, &clientErr):
+		logger.Error("authorization failed", "step", clientErr.Step, "cause", clientErr.Err.Error())
+	default:
+		logger.Error(err.Error())
+	}
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"gmailexport/app/exporter"
 	"gmailexport/app/getclient"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jessevdk/go-flags"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
@@ -23,75 +30,101 @@ type tFilter struct {
 	Subject   string `short:"s" long:"subject" description:"email subject"`
 }
 
-// query constructs a Gmail search query string from the filter options
-func (filter tFilter) query() string {
-	ss := []string{filter.messageId(), filter.label(), filter.from(), filter.to(), filter.subject()}
-	q := ""
-	for _, s := range ss {
-		if s != "" {
-			if q == "" {
-				q = s
-			} else {
-				q = q + " AND " + s
-			}
-		}
-	}
-	return q
-}
-
-// Helper methods to construct individual query parts
-func (filter tFilter) messageId() string {
-	s := ""
-	if filter.MessageId != "" {
-		s = "rfc822msgid:" + filter.MessageId
+// toFilter converts the command line options to the exporter filter
+func (filter tFilter) toFilter() exporter.TFilter {
+	return exporter.TFilter{
+		MessageId: filter.MessageId,
+		Label:     filter.Label,
+		From:      filter.From,
+		To:        filter.To,
+		Subject:   filter.Subject,
 	}
-	return s
 }
 
-func (filter tFilter) label() string {
-	s := ""
-	if filter.Label != "" {
-		s = "label:" + filter.Label
-	}
-	return s
+// tStatement represents the output options for the exported messages
+type tStatement struct {
+	Output        string   `short:"O" long:"output" default:"stdout" optional:"non-empty" optional-value:"gmail" description:"output path: stdout - if missing, else output to file; value_of_param - template for the name (the equal sign (=) is required), or gmail - if option occurs without an argument"`
+	Split         bool     `short:"S" long:"split" description:"split output into multiple files"`
+	Format        string   `short:"F" long:"format" default:"json" description:"output format; the formats command describes them"`
+	Append        bool     `long:"append" description:"append to the output file if it exists (ndjson only)"`
+	Area          string   `short:"A" long:"area" default:"all" description:"fullness of the output; the areas command describes them"`
+	Fields        string   `long:"fields" description:"comma-separated fields of a custom area, each [key=]source, e.g. id,date=internalDate,header:Subject,body:text; replaces --area"`
+	Config        string   `long:"config" description:"JSON configuration file; its areas section defines custom areas by name, e.g. {\"areas\": {\"brief\": \"id,header:Subject\"}}"`
+	ByThread      bool     `long:"by-thread" description:"export threads, each with its messages; with --split one file per thread"`
+	Conversations bool     `long:"conversations" description:"rebuild reply trees from the Message-ID, In-Reply-To and References headers and add each message's parent and depth"`
+	Dedup         string   `long:"dedup" choice:"id" choice:"content" description:"skip messages exported before: id - by Gmail ID; content - also by Message-ID header and body hash"`
+	Index         string   `long:"index" description:"dedup index file (default: .gmailexport-index in the output directory)"`
+	Columns       string   `long:"columns" default:"id,date,from,to,subject,labels,snippet,size,attachments" description:"comma-separated columns of the csv and tsv formats"`
+	Separator     string   `long:"separator" default:"; " description:"joins the values of multi-valued csv and tsv columns such as to and labels"`
+	BOM           bool     `long:"bom" description:"start csv and tsv files with a byte order mark for Excel"`
+	RowGroupSize  int      `long:"row-group-size" default:"10000" description:"number of messages per parquet row group"`
+	Compression   string   `long:"compression" choice:"none" choice:"snappy" choice:"gzip" choice:"zstd" choice:"lz4" default:"snappy" description:"parquet compression codec"`
+	Compress      string   `long:"compress" choice:"gzip" choice:"zstd" choice:"zip" choice:"tar.gz" choice:"tar.zst" description:"compress every output file with gzip or zstd, or write a split export into a zip, tar.gz or tar.zst archive with a manifest; an output ending with .gz, .zst, .zip, .tar.gz or .tar.zst selects it too"`
+	PdfFont       string   `long:"pdf-font" description:"TrueType font file for the pdf format, for characters outside Windows-1252"`
+	EncryptTo     []string `long:"encrypt-to" description:"encrypt every output file for the recipient, an age public key (age1...), an SSH public key, or a file of age recipients or OpenPGP public keys; may be repeated. The files get the extension .age or .gpg"`
+	Redact        bool     `long:"redact" description:"mask email addresses, phone numbers, IBANs and card numbers, or what the redact section of the --config file says, and record the rules that fired"`
+	Manifest      string   `long:"manifest" description:"path of the manifest listing the files and messages of the export with their SHA-256 (default: the output without its extension, followed by .manifest.json; none for stdout)"`
+	Template      string   `long:"template" description:"render each message with a Go text/template file instead of the format; the file may define header and footer templates"`
+	OnError       string   `long:"on-error" choice:"fail" choice:"skip" choice:"retry" default:"fail" description:"when a message cannot be fetched or formatted: fail - stop the export; skip - skip the message; retry - fetch it up to 3 times, then skip it. Skipped messages are listed with the reason in the errors file and the exit status is 2"`
+	ErrorsFile    string   `long:"errors-file" description:"path of the JSON lines of the messages skipped by --on-error=skip or retry (default: the output without its extension, followed by .errors.ndjson; none for stdout)"`
 }
 
-func (filter tFilter) from() string {
-	s := ""
-	if filter.From != "" {
-		s = "from:" + filter.From
+// toStatement converts the command line options to the exporter statement
+func (statement tStatement) toStatement() exporter.TStatement {
+	area := statement.Area
+	if statement.Fields != "" {
+		area = fieldsArea
 	}
-	return s
-}
-
-func (filter tFilter) to() string {
-	s := ""
-	if filter.To != "" {
-		s = "to:" + filter.To
+	return exporter.TStatement{
+		Output:        statement.Output,
+		Split:         statement.Split,
+		Format:        statement.Format,
+		Append:        statement.Append,
+		Area:          area,
+		ByThread:      statement.ByThread,
+		Conversations: statement.Conversations,
+		Dedup:         statement.Dedup,
+		Index:         statement.Index,
+		Columns:       splitList(statement.Columns),
+		Separator:     statement.Separator,
+		BOM:           statement.BOM,
+		RowGroupSize:  statement.RowGroupSize,
+		Compression:   statement.Compression,
+		Compress:      statement.Compress,
+		Template:      statement.Template,
+		PdfFont:       statement.PdfFont,
+		EncryptTo:     statement.EncryptTo,
+		Manifest:      statement.Manifest,
+		OnError:       statement.OnError,
+		ErrorsFile:    statement.ErrorsFile,
 	}
-	return s
 }
 
-func (filter tFilter) subject() string {
-	s := ""
-	if filter.Subject != "" {
-		s = "subject:" + filter.Subject
-	}
-	return s
+// tConnection represents the options of the connection to Gmail
+type tConnection struct {
+	Endpoint string `long:"endpoint" description:"base URL of the Gmail API, e.g. of a stand-in server started with the serve command; requests are sent without authorization"`
 }
 
-// tStatement represents the output options for the exported messages
-type tStatement struct {
-	Output string `short:"O" long:"output" default:"stdout" optional:"non-empty" optional-value:"gmail" description:"output path: stdout - if missing, else output to file; value_of_param - template for the name (the equal sign (=) is required), or gmail - if option occurs without an argument"`
-	Split  bool   `short:"S" long:"split" description:"split output into multiple files"`
-	Format string `short:"F" long:"format" choice:"json" choice:"txt" default:"json" description:"output format"`
-	Area   string `short:"A" long:"area" choice:"raw" choice:"all" choice:"small" choice:"easy" default:"all" description:"fullness of the output"`
+// tProgressOpts represents the options of the progress display
+type tProgressOpts struct {
+	Progress         string        `long:"progress" choice:"auto" choice:"bar" choice:"log" choice:"none" default:"auto" description:"show the progress on stderr: a status line (bar), structured log lines at an interval for cron jobs (log), or nothing; auto shows the status line when stderr is a terminal"`
+	ProgressInterval time.Duration `long:"progress-interval" default:"1m" description:"interval of the log lines of --progress=log"`
 }
 
 // tOpts combines the filter and statement options
 type tOpts struct {
-	Statement tStatement `group:"Presentation of results"`
-	Filter    tFilter    `group:"Selection conditions"`
+	Statement  tStatement    `group:"Presentation of results"`
+	Filter     tFilter       `group:"Selection conditions"`
+	Connection tConnection   `group:"Connection"`
+	Progress   tProgressOpts `group:"Progress"`
+	Log        tLogOpts      `group:"Logging"`
+	Auth       tAuthCmd      `command:"auth" description:"Manage the saved authorization" long-description:"Without a command the tool exports messages; auth manages the token used for that."`
+	Labels     tLabelsCmd    `command:"labels" description:"Export the labels with message and thread counts and colours"`
+	Serve      tServeCmd     `command:"serve" description:"Serve a directory of .eml files as a local stand-in of the Gmail API"`
+	Areas      tAreasCmd     `command:"areas" description:"List the areas, with the custom areas of --config"`
+	Formats    tFormatsCmd   `command:"formats" description:"List the output formats"`
+	Decrypt    tDecryptCmd   `command:"decrypt" description:"Decrypt a file of an export encrypted with --encrypt-to"`
+	Verify     tVerifyCmd    `command:"verify" description:"Check the files of an export against its manifest"`
 }
 
 func (opts tOpts) filter() tFilter {
@@ -100,31 +133,141 @@ func (opts tOpts) filter() tFilter {
 
 func main() {
 	var opts tOpts
-	if _, err := flags.Parse(&opts); err != nil {
+	opts.Labels.connection = &opts.Connection
+	err := defineConfigAreas(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	parser := flags.NewParser(&opts, flags.Default)
+	setChoices(parser)
+	parser.SubcommandsOptional = true
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		logger := newLogger(opts.Log, os.Stderr)
+		slog.SetDefault(logger)
+		if command == nil {
+			err = runExport(opts)
+		} else {
+			err = command.Execute(args)
+		}
+		if err != nil {
+			logError(logger, err)
+			os.Exit(exitFailure)
+		}
+		return nil
+	}
+	if _, err := parser.Parse(); err != nil {
 		os.Exit(1)
 	}
+}
 
-	ctx := context.Background()
-	b, err := os.ReadFile("credentials.json")
+// splitList returns the items of a comma-separated option value without surrounding spaces
+func splitList(value string) []string {
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
+
+// The exit statuses of an export: exitFailure when an error stopped it or every message failed,
+// exitPartial when some messages were skipped on error and exitInterrupted after Ctrl-C
+const (
+	exitFailure     = 1
+	exitPartial     = 2
+	exitInterrupted = 130
+)
+
+// runExport exports the messages selected by the options.
+// Ctrl-C (or SIGTERM) stops the export: the output written so far is closed properly
+// and a summary is printed. A second Ctrl-C terminates the process immediately.
+func runExport(opts tOpts) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := opts.Statement.defineFieldsArea()
+	if err != nil {
+		return err
+	}
+	statement := opts.Statement.toStatement()
+	statement.Redact, err = opts.Statement.redactConfig()
+	if err != nil {
+		return err
+	}
+	srv, err := newService(ctx, opts.Connection.Endpoint, gmail.GmailReadonlyScope)
+	if err != nil {
+		return err
+	}
+
+	e := exporter.New(srv, user, opts.filter().toFilter(), statement)
+	display := newProgressDisplay(opts.Progress.Progress, opts.Progress.ProgressInterval)
+	// The log records of the export are written between the redraws of the status line
+	slog.SetDefault(display.wrap(slog.Default()))
+	e.SetLogger(slog.Default())
+	if display != nil {
+		e.SetProgress(display.update)
+	}
+	summary, err := e.Export(ctx)
+	display.stop()
+	if ctx.Err() != nil {
+		unit := "messages"
+		if opts.Statement.ByThread {
+			unit = "threads"
+		}
+		slog.Warn("interrupted", "unit", unit, "found", summary.Found, "exported", summary.Exported,
+			"duplicates", summary.Duplicates, "failed", len(summary.Failed), "remaining", summary.Remaining())
+		os.Exit(exitInterrupted)
+	}
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		return err
 	}
+	if summary.Duplicates > 0 {
+		slog.Info("duplicates skipped", "duplicates", summary.Duplicates)
+	}
+	if len(summary.Failed) > 0 {
+		slog.Warn("partial export", "found", summary.Found, "exported", summary.Exported, "failed", len(summary.Failed))
+		os.Exit(exitPartial)
+	}
+	return nil
+}
 
-	// If modifying these scopes, delete your previously saved token.json.
-	config, err := google.ConfigFromJSON(b, gmail.GmailReadonlyScope)
+// newConfig reads the client secret file and returns the OAuth config for the scopes.
+func newConfig(scopes ...string) (*oauth2.Config, error) {
+	b, err := os.ReadFile("credentials.json")
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
+		return nil, fmt.Errorf("unable to read client secret file: %w", err)
 	}
-	client := getclient.GetClient(config)
 
-	srv, err := gmail.NewService(ctx, option.WithHTTPClient(client))
+	// A saved token granted for other scopes is replaced by getclient, which asks for consent again.
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
-		log.Fatalf("Unable to retrieve Gmail client: %v", err)
+		return nil, fmt.Errorf("unable to parse client secret file to config: %w", err)
 	}
+	return config, nil
+}
 
-	err = export(srv, user, opts)
+// newService returns a Gmail service authorized for the scopes.
+// With an endpoint the service sends unauthorized requests to it instead of Google.
+func newService(ctx context.Context, endpoint string, scopes ...string) (*gmail.Service, error) {
+	if endpoint != "" {
+		return gmail.NewService(ctx, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	}
+	config, err := newConfig(scopes...)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getclient.GetClient(config)
 	if err != nil {
-		log.Fatalf("Func export: %v", err)
+		return nil, err
 	}
 
+	srv, err := gmail.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Gmail client: %w", err)
+	}
+	return srv, nil
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gmailexport/app/exporter"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// barInterval is how often the status line is redrawn
+const barInterval = 250 * time.Millisecond
+
+// tProgressDisplay shows the progress of an export on stderr, as a status line redrawn in place
+// or as structured log lines at an interval. The export updates the state; a goroutine shows it.
+type tProgressDisplay struct {
+	mu      sync.Mutex
+	state   exporter.TProgress
+	changed bool
+	// drawn: the status line is on the screen, not followed by a newline
+	drawn   bool
+	out     io.Writer
+	logger  *slog.Logger
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// newProgressDisplay returns the display of the mode: "bar", "log", "none", or "auto" for the bar
+// when stderr is a terminal and none otherwise. It returns nil for none.
+func newProgressDisplay(mode string, interval time.Duration) *tProgressDisplay {
+	if mode == "auto" {
+		mode = "none"
+		if isTerminal(os.Stderr) {
+			mode = "bar"
+		}
+	}
+	d := &tProgressDisplay{out: os.Stderr, done: make(chan struct{}), stopped: make(chan struct{})}
+	switch mode {
+	case "bar":
+		interval = barInterval
+	case "log":
+		d.logger = slog.Default()
+	default:
+		return nil
+	}
+	go d.run(interval)
+	return d
+}
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update keeps the state, to be shown at the next tick
+func (d *tProgressDisplay) update(state exporter.TProgress) {
+	d.mu.Lock()
+	d.state = state
+	d.changed = true
+	d.mu.Unlock()
+}
+
+func (d *tProgressDisplay) run(interval time.Duration) {
+	defer close(d.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.show(false)
+		case <-d.done:
+			d.show(true)
+			return
+		}
+	}
+}
+
+// show draws the status line or logs the state; the log lines are only written when the state
+// changed, except the last one
+func (d *tProgressDisplay) show(last bool) {
+	d.mu.Lock()
+	state, changed := d.state, d.changed
+	d.changed = false
+	if d.logger == nil {
+		// The status line is drawn under the lock, so that the log records do not cut into it
+		defer d.mu.Unlock()
+	} else {
+		d.mu.Unlock()
+	}
+	if state.Started.IsZero() || !changed && d.logger != nil && !last {
+		return
+	}
+	now := time.Now()
+	if d.logger == nil {
+		fmt.Fprint(d.out, "\r\033[K"+state.Status(now))
+		d.drawn = !last
+		if last {
+			fmt.Fprintln(d.out)
+		}
+		return
+	}
+	phase := "exporting"
+	switch {
+	case state.Listing:
+		phase = "listing"
+	case last:
+		phase = "done"
+	}
+	d.logger.Info("progress", "phase", phase, "unit", state.Unit, "listed", state.Listed,
+		"resultSizeEstimate", state.ResultSizeEstimate, "found", state.Found, "fetched", state.Fetched,
+		"formatted", state.Formatted, "written", state.Written, "duplicates", state.Duplicates,
+		"failed", state.Failed, "bytes", state.Bytes, "rate", fmt.Sprintf("%.2f", state.Rate(now)), "eta", state.ETA(now))
+}
+
+// wrap returns the logger writing its records on lines of their own while the status line is shown,
+// the logger itself for the other modes
+func (d *tProgressDisplay) wrap(logger *slog.Logger) *slog.Logger {
+	if d == nil || d.logger != nil {
+		return logger
+	}
+	return slog.New(&tBarHandler{Handler: logger.Handler(), display: d})
+}
+
+// tBarHandler clears the status line of the display before each record of the handler, which
+// shares stderr with it; the status line is drawn again at the next tick
+type tBarHandler struct {
+	slog.Handler
+	display *tProgressDisplay
+}
+
+func (h *tBarHandler) Handle(ctx context.Context, record slog.Record) error {
+	d := h.display
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.drawn {
+		fmt.Fprint(d.out, "\r\033[K")
+		d.drawn = false
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *tBarHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &tBarHandler{Handler: h.Handler.WithAttrs(attrs), display: h.display}
+}
+
+func (h *tBarHandler) WithGroup(name string) slog.Handler {
+	return &tBarHandler{Handler: h.Handler.WithGroup(name), display: h.display}
+}
+
+// stop shows the last state and stops the display
+func (d *tProgressDisplay) stop() {
+	if d == nil {
+		return
+	}
+	close(d.done)
+	<-d.stopped
+}
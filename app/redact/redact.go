@@ -0,0 +1,421 @@
+// Package redact removes personal data from exported messages: it drops or hashes headers,
+// masks email addresses (keeping the domain) and replaces the matches of regular expressions,
+// such as phone numbers, IBANs and card numbers, in the texts of the messages.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TRule replaces the matches of a regular expression in the texts of the messages
+type TRule struct {
+	// Name: The name of the rule, recorded in the messages where it fired.
+	Name string `json:"name"`
+	// Pattern: A regular expression of package regexp.
+	Pattern string `json:"pattern"`
+	// Replacement: Replaces each match; "[name]" if empty.
+	Replacement string `json:"replacement"`
+}
+
+// TConfig selects what is redacted
+type TConfig struct {
+	// DropHeaders: The headers removed from the messages.
+	DropHeaders []string `json:"dropHeaders"`
+	// HashHeaders: The headers whose values are replaced by a hash, so that equal values stay equal.
+	HashHeaders []string `json:"hashHeaders"`
+	// HashSalt: Prefixed to the values before hashing, so that known values cannot be recognised.
+	HashSalt string `json:"hashSalt"`
+	// MaskEmails: Replaces the local part of email addresses with "***", in headers and texts.
+	MaskEmails bool `json:"maskEmails"`
+	// Rules: The names of built-in rules to apply: phone, iban and card.
+	Rules []string `json:"rules"`
+	// Patterns: Rules of their own, applied after the built-in ones.
+	Patterns []TRule `json:"patterns"`
+}
+
+// DefaultConfig masks email addresses and applies every built-in rule
+var DefaultConfig = TConfig{MaskEmails: true, Rules: []string{"card", "iban", "phone"}}
+
+// tRule is a compiled rule; check, if set, tells whether a match is really what the rule looks for
+type tRule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+	check       func(match string) bool
+}
+
+// builtinRules are the rules that can be selected by name. Card numbers come first, so that
+// they are not taken for phone numbers.
+var builtinRules = map[string]tRule{
+	"card":  {name: "card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), replacement: "[card]", check: luhn},
+	"iban":  {name: "iban", re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), replacement: "[iban]", check: ibanChecksum},
+	"phone": {name: "phone", re: phonePattern, replacement: "[phone]", check: phoneDigits},
+}
+
+// phonePattern matches the shapes of phone numbers: international numbers starting with "+",
+// numbers with an area code in parentheses, and groups of 2 to 4 digits joined by one kind of
+// separator, such as 555-123-4567. Bare runs of digits, such as reference numbers, are left alone.
+var phonePattern = regexp.MustCompile(`\+\d[\d .()-]{5,}\d` +
+	`|\(\d{1,4}\)[ .-]?\d[\d .-]{4,}\d` +
+	`|\b\d{2,4}(?:-\d{2,4}){2,4}\b` +
+	`|\b\d{2,4}(?:\.\d{2,4}){2,4}\b` +
+	`|\b\d{2,4}(?: \d{2,4}){2,4}\b`)
+
+// builtinOrder is the order the built-in rules are applied in
+var builtinOrder = []string{"card", "iban", "phone"}
+
+// addressHeaders are the headers whose values are address lists, by lower-case name
+var addressHeaders = map[string]bool{
+	"from": true, "to": true, "cc": true, "bcc": true, "reply-to": true, "sender": true,
+	"delivered-to": true, "return-path": true,
+}
+
+// verbatimHeaders are the headers left as they are, unless they are dropped or hashed, by
+// lower-case name: the message IDs link the messages of a conversation, and the content headers
+// hold the structure of the MIME parts, such as the boundaries of multipart bodies
+var verbatimHeaders = map[string]bool{
+	"message-id": true, "in-reply-to": true, "references": true,
+	"content-type": true, "content-transfer-encoding": true,
+}
+
+// emailPattern matches email addresses in texts
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+
+// TRedactor applies a configuration to the messages
+type TRedactor struct {
+	drop       map[string]bool
+	hash       map[string]bool
+	salt       string
+	maskEmails bool
+	rules      []tRule
+}
+
+// New compiles the configuration
+func New(config TConfig) (*TRedactor, error) {
+	r := &TRedactor{drop: map[string]bool{}, hash: map[string]bool{}, salt: config.HashSalt, maskEmails: config.MaskEmails}
+	for _, name := range config.DropHeaders {
+		r.drop[strings.ToLower(name)] = true
+	}
+	for _, name := range config.HashHeaders {
+		r.hash[strings.ToLower(name)] = true
+	}
+	selected := map[string]bool{}
+	for _, name := range config.Rules {
+		if _, ok := builtinRules[name]; !ok {
+			return nil, fmt.Errorf("unknown redaction rule %q, the built-in rules are %s", name, strings.Join(builtinOrder, ", "))
+		}
+		selected[name] = true
+	}
+	for _, name := range builtinOrder {
+		if selected[name] {
+			r.rules = append(r.rules, builtinRules[name])
+		}
+	}
+	for _, p := range config.Patterns {
+		if p.Name == "" {
+			return nil, fmt.Errorf("redaction pattern %q without a name", p.Pattern)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %s: %w", p.Name, err)
+		}
+		replacement := p.Replacement
+		if replacement == "" {
+			replacement = "[" + p.Name + "]"
+		}
+		r.rules = append(r.rules, tRule{name: p.Name, re: re, replacement: replacement})
+	}
+	return r, nil
+}
+
+// Session returns a session that records the rules fired in one message
+func (r *TRedactor) Session() *TSession {
+	return &TSession{redactor: r, fired: map[string]bool{}}
+}
+
+// TSession redacts the fields of one message and records the rules that fired
+type TSession struct {
+	redactor *TRedactor
+	fired    map[string]bool
+}
+
+// Header returns the redacted value of a header, and false if the header is dropped.
+// Message IDs and MIME content headers are only dropped or hashed.
+func (s *TSession) Header(name, value string) (string, bool) {
+	r := s.redactor
+	key := strings.ToLower(name)
+	if r.drop[key] {
+		s.fired["drop:"+name] = true
+		return "", false
+	}
+	if r.hash[key] {
+		s.fired["hash:"+name] = true
+		sum := sha256.Sum256([]byte(r.salt + value))
+		return "sha256:" + hex.EncodeToString(sum[:16]), true
+	}
+	if verbatimHeaders[key] {
+		return value, true
+	}
+	if r.maskEmails && addressHeaders[key] {
+		return s.apply(s.maskAddresses(value), false), true
+	}
+	return s.apply(value, true), true
+}
+
+// Text returns the text with the email addresses masked and the matches of the rules replaced
+func (s *TSession) Text(text string) string {
+	return s.apply(text, true)
+}
+
+// Raw returns the RFC 2822 message with its headers redacted like Header and the texts of its
+// MIME parts like Text. Base64 and quoted-printable texts are decoded before the rules are applied
+// and encoded again after. Other parts, such as attachments, are left as they are.
+func (s *TSession) Raw(raw string) string {
+	return s.entity(raw)
+}
+
+// entity redacts the header fields of a MIME entity, then its body according to its content type
+func (s *TSession) entity(raw string) string {
+	var header, body string
+	if rest, ok := strings.CutPrefix(raw, "\r\n"); ok {
+		// An entity without header fields
+		body = rest
+	} else {
+		end := strings.Index(raw, "\r\n\r\n")
+		if end < 0 {
+			return s.Text(raw)
+		}
+		header, body = raw[:end], raw[end+4:]
+	}
+	var b strings.Builder
+	var contentType, encoding string
+	lines := strings.Split(header, "\r\n")
+	for i := 0; i < len(lines) && header != ""; i++ {
+		field := lines[i]
+		// Continuation lines start with white space
+		for i+1 < len(lines) && strings.TrimLeft(lines[i+1], " \t") != lines[i+1] {
+			i++
+			field += "\r\n" + lines[i]
+		}
+		name, value, ok := strings.Cut(field, ":")
+		if !ok {
+			b.WriteString(s.Text(field) + "\r\n")
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case "content-type":
+			contentType = value
+		case "content-transfer-encoding":
+			encoding = strings.ToLower(value)
+		}
+		value, keep := s.Header(name, value)
+		if keep {
+			b.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	b.WriteString(s.body(body, contentType, encoding))
+	return b.String()
+}
+
+// body redacts the body of a MIME entity: the parts of multipart bodies and attached messages
+// one by one, and texts after decoding them. The content type is text/plain if it is not given.
+func (s *TSession) body(body, contentType, encoding string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		return s.multipart(body, params["boundary"])
+	case mediaType == "message/rfc822" && encoding != "base64" && encoding != "quoted-printable":
+		return s.entity(body)
+	case strings.HasPrefix(mediaType, "text/"):
+		return s.encoded(body, encoding)
+	}
+	return body
+}
+
+// multipart redacts the parts of a multipart body, leaving the preamble, the delimiters and the
+// epilogue as they are
+func (s *TSession) multipart(body, boundary string) string {
+	delimiter := "\r\n--" + boundary
+	parts := strings.Split("\r\n"+body, delimiter)
+	for i := 1; i < len(parts); i++ {
+		if strings.HasPrefix(parts[i], "--") {
+			// The close delimiter, followed by the epilogue
+			break
+		}
+		// The rest of the delimiter line may hold white space
+		eol := strings.Index(parts[i], "\r\n")
+		if eol < 0 {
+			continue
+		}
+		parts[i] = parts[i][:eol+2] + s.entity(parts[i][eol+2:])
+	}
+	return strings.Join(parts, delimiter)[2:]
+}
+
+// encoded redacts a text in its content transfer encoding
+func (s *TSession) encoded(text, encoding string) string {
+	switch encoding {
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return s.Text(text)
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(s.Text(string(decoded))))
+		var b strings.Builder
+		for len(encoded) > 76 {
+			b.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		b.WriteString(encoded)
+		if strings.HasSuffix(text, "\r\n") {
+			b.WriteString("\r\n")
+		}
+		return b.String()
+	case "quoted-printable":
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(text)))
+		if err != nil {
+			return s.Text(text)
+		}
+		var b strings.Builder
+		w := quotedprintable.NewWriter(&b)
+		if _, err := io.WriteString(w, s.Text(string(decoded))); err != nil {
+			return s.Text(text)
+		}
+		if err := w.Close(); err != nil {
+			return s.Text(text)
+		}
+		return b.String()
+	}
+	return s.Text(text)
+}
+
+// Fired returns the names of the rules that fired, sorted
+func (s *TSession) Fired() []string {
+	if len(s.fired) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(s.fired))
+	for name := range s.fired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply masks the email addresses of the text, unless they are masked already, then replaces
+// the matches of the rules
+func (s *TSession) apply(text string, emails bool) string {
+	r := s.redactor
+	if emails && r.maskEmails {
+		text = emailPattern.ReplaceAllStringFunc(text, func(address string) string {
+			s.fired["email"] = true
+			return maskAddress(address)
+		})
+	}
+	for _, rule := range r.rules {
+		text = rule.re.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.check != nil && !rule.check(match) {
+				return match
+			}
+			s.fired[rule.name] = true
+			return rule.replacement
+		})
+	}
+	return text
+}
+
+// maskAddresses masks the addresses of a header value, keeping the display names out
+// as they are usually the names of people
+func (s *TSession) maskAddresses(value string) string {
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return emailPattern.ReplaceAllStringFunc(value, func(address string) string {
+			s.fired["email"] = true
+			return maskAddress(address)
+		})
+	}
+	masked := make([]string, len(list))
+	for i, a := range list {
+		s.fired["email"] = true
+		masked[i] = maskAddress(a.Address)
+	}
+	return strings.Join(masked, ", ")
+}
+
+// maskAddress replaces the local part of an address with "***"
+func maskAddress(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "***"
+	}
+	return "***" + address[at:]
+}
+
+// digits returns the digits of the text
+func digits(text string) string {
+	var b strings.Builder
+	for _, c := range text {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// luhn reports whether the digits of the match pass the Luhn check of card numbers
+func luhn(match string) bool {
+	d := digits(match)
+	sum := 0
+	for i := len(d) - 1; i >= 0; i-- {
+		n := int(d[i] - '0')
+		if (len(d)-i)%2 == 0 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+// ibanChecksum reports whether the match has a valid IBAN checksum (ISO 13616, mod 97)
+func ibanChecksum(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	var numeric strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			numeric.WriteString(fmt.Sprint(int(c-'A') + 10))
+		} else {
+			numeric.WriteRune(c)
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// phoneDigits reports whether the match has as many digits as a phone number, rather than a date
+// or an amount: 7 to 15 for an international number, 9 to 15 for others
+func phoneDigits(match string) bool {
+	n := len(digits(match))
+	if strings.HasPrefix(match, "+") {
+		return n >= 7 && n <= 15
+	}
+	return n >= 9 && n <= 15
+}
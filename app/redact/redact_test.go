@@ -0,0 +1,104 @@
+package redact
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestText(t *testing.T) {
+	r, err := New(DefaultConfig)
+	require.NoError(t, err)
+	s := r.Session()
+
+	text := s.Text("Mail alice.smith@example.com or call +44 20 7946 0958.\n" +
+		"Card 4111 1111 1111 1111, IBAN GB82 WEST 1234 5698 7654 32.\n" +
+		"Order 12345 of 2021-05-03 costs 1 250.00")
+	assert.Equal(t, "Mail ***@example.com or call [phone].\n"+
+		"Card [card], IBAN [iban].\n"+
+		"Order 12345 of 2021-05-03 costs 1 250.00", text)
+	assert.Equal(t, []string{"card", "email", "iban", "phone"}, s.Fired())
+}
+
+func TestPhone(t *testing.T) {
+	r, err := New(TConfig{Rules: []string{"phone"}})
+	require.NoError(t, err)
+	s := r.Session()
+
+	assert.Equal(t, "Meeting on 2021-05-03 10:00, invoice 123456789, on 03.05.2021",
+		s.Text("Meeting on 2021-05-03 10:00, invoice 123456789, on 03.05.2021"))
+	assert.Nil(t, s.Fired())
+	assert.Equal(t, "Call [phone], [phone] or [phone].",
+		s.Text("Call (555) 123-4567, 555-123-4567 or +380 44 123 4567."))
+}
+
+func TestHeader(t *testing.T) {
+	r, err := New(TConfig{DropHeaders: []string{"Received"}, HashHeaders: []string{"Message-ID"}, HashSalt: "salt", MaskEmails: true})
+	require.NoError(t, err)
+	s := r.Session()
+
+	_, keep := s.Header("received", "from mx.example.com")
+	assert.False(t, keep)
+	hashed, keep := s.Header("Message-ID", "<1@example.com>")
+	assert.True(t, keep)
+	assert.Regexp(t, `^sha256:[0-9a-f]{32}$`, hashed)
+	again, _ := r.Session().Header("Message-ID", "<1@example.com>")
+	assert.Equal(t, hashed, again)
+
+	from, _ := s.Header("From", `"Alice Smith" <alice@example.com>, bob@example.org`)
+	assert.Equal(t, "***@example.com, ***@example.org", from)
+	subject, _ := s.Header("Subject", "Hello")
+	assert.Equal(t, "Hello", subject)
+	assert.Equal(t, []string{"drop:received", "email", "hash:Message-ID"}, s.Fired())
+
+	inReplyTo, _ := s.Header("In-Reply-To", "<2@mail.example.com>")
+	assert.Equal(t, "<2@mail.example.com>", inReplyTo)
+}
+
+func TestRaw(t *testing.T) {
+	r, err := New(TConfig{DropHeaders: []string{"Received"}, MaskEmails: true})
+	require.NoError(t, err)
+
+	raw := "Received: from a\r\n\tby b\r\nFrom: alice@example.com\r\nSubject: Hi\r\n\r\nWrite to bob@example.org\r\n"
+	assert.Equal(t, "From: ***@example.com\r\nSubject: Hi\r\n\r\nWrite to ***@example.org\r\n", r.Session().Raw(raw))
+}
+
+func TestRawEncoded(t *testing.T) {
+	r, err := New(DefaultConfig)
+	require.NoError(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString([]byte("Call +44 20 7946 0958 or mail bob@example.org\r\n"))
+	raw := "Content-Type: multipart/alternative; boundary=\"000000000000a1b2\"\r\n\r\n" +
+		"--000000000000a1b2\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		encoded + "\r\n" +
+		"--000000000000a1b2\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Write to alice@exa=\r\nmple.com\r\n" +
+		"--000000000000a1b2--\r\n"
+	redacted := base64.StdEncoding.EncodeToString([]byte("Call [phone] or mail ***@example.org\r\n"))
+	assert.Equal(t, "Content-Type: multipart/alternative; boundary=\"000000000000a1b2\"\r\n\r\n"+
+		"--000000000000a1b2\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: base64\r\n\r\n"+
+		redacted+"\r\n"+
+		"--000000000000a1b2\r\n"+
+		"Content-Type: text/html; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n"+
+		"Write to ***@example.com\r\n"+
+		"--000000000000a1b2--\r\n", r.Session().Raw(raw))
+}
+
+func TestPatterns(t *testing.T) {
+	r, err := New(TConfig{Patterns: []TRule{{Name: "ticket", Pattern: `TCK-\d+`}}})
+	require.NoError(t, err)
+	s := r.Session()
+	assert.Equal(t, "See [ticket].", s.Text("See TCK-42."))
+	assert.Equal(t, []string{"ticket"}, s.Fired())
+	assert.Nil(t, r.Session().Fired())
+
+	_, err = New(TConfig{Rules: []string{"ssn"}})
+	assert.ErrorContains(t, err, `unknown redaction rule "ssn"`)
+	_, err = New(TConfig{Patterns: []TRule{{Name: "bad", Pattern: `(`}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"gmailexport/app/areas"
+	"gmailexport/app/exporter"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// setChoices sets the choices of the area and format options from the registries
+func setChoices(parser *flags.Parser) {
+	var formats, labelFormats []string
+	for _, format := range exporter.Formats() {
+		formats = append(formats, format.Name)
+		if format.Area {
+			labelFormats = append(labelFormats, format.Name)
+		}
+	}
+	parser.FindOptionByLongName("area").Choices = areas.Names()
+	parser.FindOptionByLongName("format").Choices = formats
+	parser.Find("labels").FindOptionByLongName("format").Choices = labelFormats
+}
+
+// tAreasCmd lists the registered areas
+type tAreasCmd struct{}
+
+func (cmd *tAreasCmd) Execute(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, area := range areas.Areas() {
+		fmt.Fprintf(w, "%s\t%s\n", area.Name, area.Description)
+	}
+	return w.Flush()
+}
+
+// tFormatsCmd lists the registered output formats
+type tFormatsCmd struct{}
+
+func (cmd *tFormatsCmd) Execute(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, format := range exporter.Formats() {
+		applies := "area all only"
+		if format.Area {
+			applies = "per area"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", format.Name, applies, format.Description)
+	}
+	return w.Flush()
+}
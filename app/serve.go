@@ -0,0 +1,25 @@
+package main
+
+import (
+	"gmailexport/app/standin"
+	"log/slog"
+	"net/http"
+)
+
+// tServeCmd serves a directory of .eml files as a local stand-in of the Gmail API
+type tServeCmd struct {
+	Dir      string `long:"dir" required:"true" description:"directory of .eml files; files in subdirectories are labelled with the subdirectory path"`
+	Addr     string `long:"addr" default:"localhost:8025" description:"address to listen on"`
+	PageSize int    `long:"page-size" default:"100" description:"number of items in a page of a list response"`
+}
+
+func (cmd *tServeCmd) Execute(args []string) error {
+	mailbox, err := standin.LoadDir(cmd.Dir)
+	if err != nil {
+		return err
+	}
+	mailbox.PageSize = cmd.PageSize
+
+	slog.Info("serving", "dir", cmd.Dir, "endpoint", "http://"+cmd.Addr+"/")
+	return http.ListenAndServe(cmd.Addr, standin.NewServer(mailbox))
+}
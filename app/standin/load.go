@@ -0,0 +1,58 @@
+package standin
+
+import (
+	"fmt"
+	"gmailexport/app/gmailapi/fake"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// LoadDir returns a mailbox with the .eml files of the directory.
+// Files in the directory itself are in the INBOX. Files in subdirectories get a user label
+// named after the subdirectory path, so dir/Work/Clients/a.eml is labelled "Work/Clients".
+// The files are read in lexical order, and replies are put in the thread of a message read before them.
+func LoadDir(dir string) (*fake.Mailbox, error) {
+	mailbox := fake.New()
+	labels := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".eml") {
+			return nil
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		message, err := fake.ParseMessage(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			// Gmail nested labels have their parents as labels too
+			segments := strings.Split(filepath.ToSlash(rel), "/")
+			for i := range segments {
+				name := strings.Join(segments[:i+1], "/")
+				if _, ok := labels[name]; !ok {
+					labels[name] = mailbox.AddLabel(&gmail.Label{Name: name})
+				}
+			}
+			message.LabelIds = []string{labels[filepath.ToSlash(rel)]}
+		}
+		mailbox.AddMessage(message)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mailbox, nil
+}
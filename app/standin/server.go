@@ -0,0 +1,153 @@
+// Package standin serves the subset of the Gmail REST API used by the tool from an
+// in-memory mailbox, so that the tool can be run against it offline with --endpoint.
+package standin
+
+import (
+	"encoding/json"
+	"errors"
+	"gmailexport/app/gmailapi/fake"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/api/googleapi"
+)
+
+// tServer answers Gmail API requests from the mailbox
+type tServer struct {
+	mailbox *fake.Mailbox
+}
+
+// NewServer returns a handler serving the mailbox at the Gmail API paths:
+// messages.list (paging and q; maxResults is ignored, see fake.Mailbox.PageSize),
+// messages.get in all formats, messages.attachments.get, threads.list, threads.get,
+// labels.list, labels.get, history.list and getProfile.
+// Use the server URL as the endpoint of a Gmail service.
+// Every request is logged at the debug level by the default logger of package slog.
+func NewServer(mailbox *fake.Mailbox) http.Handler {
+	s := &tServer{mailbox: mailbox}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /gmail/v1/users/{user}/messages", s.listMessages)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/messages/{id}", s.getMessage)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/messages/{messageId}/attachments/{id}", s.getAttachment)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/threads", s.listThreads)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/threads/{id}", s.getThread)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/labels", s.listLabels)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/labels/{id}", s.getLabel)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/history", s.listHistory)
+	mux.HandleFunc("GET /gmail/v1/users/{user}/profile", s.getProfile)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &googleapi.Error{Code: http.StatusNotFound, Message: "Not Found"})
+	})
+	return logRequests(s.checkUser(mux))
+}
+
+// tStatusWriter records the status of a response
+type tStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *tStatusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the method, path, query and status of each request
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &tStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		slog.Debug("request", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery, "status", sw.status)
+	})
+}
+
+// checkUser rejects requests for other mailboxes than "me" or the mailbox address
+func (s *tServer) checkUser(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gmail/v1/users/{user}/", func(w http.ResponseWriter, r *http.Request) {
+		user := r.PathValue("user")
+		if user != "me" && user != s.mailbox.Address {
+			writeError(w, &googleapi.Error{Code: http.StatusBadRequest, Message: "Delegation denied for " + s.mailbox.Address})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	mux.Handle("/", next)
+	return mux
+}
+
+func (s *tServer) listMessages(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.ListMessages(r.Context(), r.PathValue("user"), r.FormValue("q"), r.FormValue("pageToken"))
+	write(w, resp, err)
+}
+
+func (s *tServer) getMessage(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.GetMessage(r.Context(), r.PathValue("user"), r.PathValue("id"), r.FormValue("format"))
+	write(w, resp, err)
+}
+
+func (s *tServer) getAttachment(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.GetAttachment(r.Context(), r.PathValue("user"), r.PathValue("messageId"), r.PathValue("id"))
+	write(w, resp, err)
+}
+
+func (s *tServer) listThreads(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.ListThreads(r.Context(), r.PathValue("user"), r.FormValue("q"), r.FormValue("pageToken"))
+	write(w, resp, err)
+}
+
+func (s *tServer) getThread(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.GetThread(r.Context(), r.PathValue("user"), r.PathValue("id"), r.FormValue("format"))
+	write(w, resp, err)
+}
+
+func (s *tServer) listLabels(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.ListLabels(r.Context(), r.PathValue("user"))
+	write(w, resp, err)
+}
+
+func (s *tServer) getLabel(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.GetLabel(r.Context(), r.PathValue("user"), r.PathValue("id"))
+	write(w, resp, err)
+}
+
+func (s *tServer) listHistory(w http.ResponseWriter, r *http.Request) {
+	startHistoryId, err := strconv.ParseUint(r.FormValue("startHistoryId"), 10, 64)
+	if err != nil {
+		writeError(w, &googleapi.Error{Code: http.StatusBadRequest, Message: "Invalid startHistoryId"})
+		return
+	}
+	resp, err := s.mailbox.ListHistory(r.Context(), r.PathValue("user"), startHistoryId, r.FormValue("pageToken"))
+	write(w, resp, err)
+}
+
+func (s *tServer) getProfile(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.mailbox.GetProfile(r.Context(), r.PathValue("user"))
+	write(w, resp, err)
+}
+
+// write writes the response as JSON, or the error
+func write(w http.ResponseWriter, resp interface{}, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeError writes the error in the format of the Google APIs
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := &googleapi.Error{Code: http.StatusInternalServerError, Message: err.Error()}
+	errors.As(err, &apiErr)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(apiErr.Code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    apiErr.Code,
+			"message": apiErr.Message,
+			"status":  http.StatusText(apiErr.Code),
+		},
+	})
+}
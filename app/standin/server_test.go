@@ -0,0 +1,142 @@
+package standin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"gmailexport/app/exporter"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// newTestService returns a Gmail service connected to a stand-in server of the testdata directory
+func newTestService(t *testing.T, pageSize int) *gmail.Service {
+	mailbox, err := LoadDir("testdata")
+	require.NoError(t, err)
+	mailbox.PageSize = pageSize
+	server := httptest.NewServer(NewServer(mailbox))
+	t.Cleanup(server.Close)
+
+	srv, err := gmail.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	return srv
+}
+
+func TestLoadDir(t *testing.T) {
+	mailbox, err := LoadDir("testdata")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	list, err := mailbox.ListMessages(ctx, "me", "", "")
+	require.NoError(t, err)
+	assert.Len(t, list.Messages, 3)
+
+	labels, err := mailbox.ListLabels(ctx, "me")
+	require.NoError(t, err)
+	var names []string
+	for _, l := range labels.Labels {
+		if l.Type == "user" {
+			names = append(names, l.Name)
+		}
+	}
+	assert.Equal(t, []string{"Work", "Work/Clients"}, names)
+
+	threads, err := mailbox.ListThreads(ctx, "me", "", "")
+	require.NoError(t, err)
+	assert.Len(t, threads.Threads, 2)
+}
+
+func TestServerMessages(t *testing.T) {
+	srv := newTestService(t, 2)
+
+	first, err := srv.Users.Messages.List("me").Do()
+	require.NoError(t, err)
+	require.Len(t, first.Messages, 2)
+	require.NotEmpty(t, first.NextPageToken)
+	second, err := srv.Users.Messages.List("me").PageToken(first.NextPageToken).Do()
+	require.NoError(t, err)
+	assert.Len(t, second.Messages, 1)
+
+	found, err := srv.Users.Messages.List("me").Q("from:bob@acme.example has:attachment").Do()
+	require.NoError(t, err)
+	require.Len(t, found.Messages, 1)
+	id := found.Messages[0].Id
+
+	full, err := srv.Users.Messages.Get("me", id).Format("full").Do()
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", full.Payload.MimeType)
+	attachment := full.Payload.Parts[1]
+	assert.Equal(t, "invoice-42.csv", attachment.Filename)
+
+	body, err := srv.Users.Messages.Attachments.Get("me", id, attachment.Body.AttachmentId).Do()
+	require.NoError(t, err)
+	data, err := base64.URLEncoding.DecodeString(body.Data)
+	require.NoError(t, err)
+	assert.Equal(t, "item,amount\nsupport,42\n", string(data))
+
+	raw, err := srv.Users.Messages.Get("me", id).Format("raw").Do()
+	require.NoError(t, err)
+	assert.Nil(t, raw.Payload)
+	assert.NotEmpty(t, raw.Raw)
+}
+
+func TestServerLabelsAndHistory(t *testing.T) {
+	srv := newTestService(t, 100)
+
+	labels, err := srv.Users.Labels.List("me").Do()
+	require.NoError(t, err)
+	assert.NotEmpty(t, labels.Labels)
+
+	history, err := srv.Users.History.List("me").StartHistoryId(1).Do()
+	require.NoError(t, err)
+	assert.Len(t, history.History, 2)
+
+	profile, err := srv.Users.GetProfile("me").Do()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), profile.MessagesTotal)
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := newTestService(t, 100)
+
+	_, err := srv.Users.Messages.Get("me", "missing").Do()
+	var apiErr *googleapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.Code)
+
+	_, err = srv.Users.Messages.List("someone@example.com").Do()
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Code)
+
+	_, err = srv.Users.History.List("me").Do()
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Code)
+}
+
+// Test the whole export through the Gmail client library and the stand-in server
+func TestExportThroughServer(t *testing.T) {
+	srv := newTestService(t, 1)
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	e := exporter.New(srv, "me", exporter.TFilter{Label: "work-clients"}, exporter.TStatement{Output: path, Format: "json", Area: "small"})
+	summary, err := e.Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Exported)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var messages []map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &messages))
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Invoice 42", messages[0]["subject"])
+	assert.Equal(t, "Please find the invoice attached.", messages[0]["plainText"])
+}
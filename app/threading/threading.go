@@ -0,0 +1,253 @@
+// Package threading rebuilds conversation trees from the Message-ID, In-Reply-To and
+// References headers, following the algorithm of Jamie Zawinski
+// (https://www.jwz.org/doc/threading.html).
+//
+// Unlike the original algorithm, messages are not grouped by subject: grouping by subject
+// is what makes Gmail put unrelated messages with the same subject in one thread.
+package threading
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TMessage is a message to thread
+type TMessage struct {
+	// Id: The Gmail ID of the message.
+	Id string
+	// MessageId: The Message-ID header.
+	MessageId string
+	// InReplyTo: The In-Reply-To header.
+	InReplyTo string
+	// References: The References header.
+	References string
+	// Subject: The Subject header, used by Render.
+	Subject string
+	// From: The From header, used by Render.
+	From string
+	// Date: The internal date of the message (epoch ms), used to order replies.
+	Date int64
+}
+
+// TNode is a message in a conversation tree. The message of a node is nil when the
+// message is referenced by others but was not given to Thread.
+type TNode struct {
+	Message   *TMessage
+	MessageId string
+	Parent    *TNode
+	Children  []*TNode
+}
+
+// Thread builds the conversation trees of the messages and returns their roots, oldest first.
+// Replies are ordered by date too.
+func Thread(messages []TMessage) []*TNode {
+	nodes := make(map[string]*TNode)
+	// order keeps the results independent of the map order
+	var order []*TNode
+	node := func(id string) *TNode {
+		n, ok := nodes[id]
+		if !ok {
+			n = &TNode{MessageId: id}
+			nodes[id] = n
+			order = append(order, n)
+		}
+		return n
+	}
+
+	for i := range messages {
+		m := &messages[i]
+		id := normalizeId(m.MessageId)
+		if id == "" || (nodes[id] != nil && nodes[id].Message != nil) {
+			// Messages without a Message-ID, or duplicates, get one of their own
+			id = fmt.Sprintf("<%s@gmail-id>", m.Id)
+		}
+		n := node(id)
+		n.Message = m
+
+		// Link the references in order, each one a reply to the one before it,
+		// keeping links made from other messages
+		refs := parseIds(m.References)
+		if inReplyTo := parseIds(m.InReplyTo); len(inReplyTo) > 0 {
+			if len(refs) == 0 || refs[len(refs)-1] != inReplyTo[0] {
+				refs = append(refs, inReplyTo[0])
+			}
+		}
+		var prev *TNode
+		for _, ref := range refs {
+			r := node(ref)
+			if prev != nil && r.Parent == nil && r != prev && !prev.descendsFrom(r) {
+				r.setParent(prev)
+			}
+			prev = r
+		}
+		// The last reference is the parent of the message, whatever was guessed before
+		if prev != nil && prev != n && !prev.descendsFrom(n) {
+			n.setParent(prev)
+		} else if n.Parent != nil {
+			n.setParent(nil)
+		}
+	}
+
+	var roots []*TNode
+	for _, n := range order {
+		if n.Parent == nil {
+			roots = append(roots, n)
+		}
+	}
+	roots = prune(roots)
+	sortNodes(roots)
+	return roots
+}
+
+// setParent moves the node under the parent, or to the root set for nil
+func (n *TNode) setParent(parent *TNode) {
+	if n.Parent != nil {
+		siblings := n.Parent.Children
+		for i, c := range siblings {
+			if c == n {
+				n.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+	n.Parent = parent
+	if parent != nil {
+		parent.Children = append(parent.Children, n)
+	}
+}
+
+// descendsFrom reports whether the node is the ancestor or one of its descendants
+func (n *TNode) descendsFrom(ancestor *TNode) bool {
+	for p := n; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// prune removes nodes without a message: childless ones are dropped and the children of the
+// others take their place. At the root level a node without a message is kept if it has
+// several children, since it joins them into one conversation.
+func prune(nodes []*TNode) []*TNode {
+	var out []*TNode
+	for _, n := range nodes {
+		n.Children = prune(n.Children)
+		for _, c := range n.Children {
+			c.Parent = n
+		}
+		if n.Message != nil {
+			out = append(out, n)
+			continue
+		}
+		if n.Parent == nil && len(n.Children) > 1 {
+			out = append(out, n)
+			continue
+		}
+		for _, c := range n.Children {
+			c.Parent = n.Parent
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// sortNodes orders the nodes and their descendants by date
+func sortNodes(nodes []*TNode) {
+	for _, n := range nodes {
+		sortNodes(n.Children)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].date() < nodes[j].date()
+	})
+}
+
+// date returns the date of the message of the node, or of its first reply
+func (n *TNode) date() int64 {
+	if n.Message != nil {
+		return n.Message.Date
+	}
+	if len(n.Children) > 0 {
+		return n.Children[0].date()
+	}
+	return 0
+}
+
+// Depth returns the number of ancestors of the node
+func (n *TNode) Depth() int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Root returns the root of the tree of the node
+func (n *TNode) Root() *TNode {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return root
+}
+
+// Walk calls fn for the nodes and their descendants, depth first in order
+func Walk(nodes []*TNode, fn func(n *TNode)) {
+	for _, n := range nodes {
+		fn(n)
+		Walk(n.Children, fn)
+	}
+}
+
+// Render draws the tree of the root as indented lines "Subject (From)", one per message.
+// The line of the marked node starts with "> ". Missing messages are shown by their Message-ID.
+func Render(root *TNode, marked *TNode) []string {
+	var lines []string
+	Walk([]*TNode{root}, func(n *TNode) {
+		prefix := "  "
+		if n == marked {
+			prefix = "> "
+		}
+		indent := strings.Repeat("   ", n.Depth())
+		if n.Depth() > 0 {
+			indent = indent[3:] + "└─ "
+		}
+		text := "(missing) " + n.MessageId
+		if n.Message != nil {
+			text = fmt.Sprintf("%s (%s)", n.Message.Subject, n.Message.From)
+		}
+		lines = append(lines, prefix+indent+text)
+	})
+	return lines
+}
+
+// parseIds returns the message IDs of a header such as References
+func parseIds(value string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(value, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(value[start:], '>')
+		if end < 0 {
+			break
+		}
+		ids = append(ids, normalizeId(value[start:start+end+1]))
+		value = value[start+end+1:]
+	}
+	return ids
+}
+
+// normalizeId returns the message ID in angle brackets without surrounding spaces
+func normalizeId(id string) string {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return ""
+	}
+	if !strings.HasPrefix(id, "<") {
+		id = "<" + id + ">"
+	}
+	return id
+}
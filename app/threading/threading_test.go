@@ -0,0 +1,81 @@
+package threading
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ids returns the Gmail IDs of the nodes in depth first order, "-" for missing messages
+func ids(roots []*TNode) []string {
+	var out []string
+	Walk(roots, func(n *TNode) {
+		if n.Message == nil {
+			out = append(out, "-")
+			return
+		}
+		out = append(out, n.Message.Id)
+	})
+	return out
+}
+
+func TestThreadReferences(t *testing.T) {
+	roots := Thread([]TMessage{
+		{Id: "3", MessageId: "<c@x>", References: "<a@x> <b@x>", Date: 3},
+		{Id: "1", MessageId: "<a@x>", Date: 1},
+		{Id: "2", MessageId: "<b@x>", InReplyTo: "<a@x>", Date: 2},
+		{Id: "4", MessageId: "<d@x>", InReplyTo: "<a@x>", Date: 4},
+	})
+	require.Len(t, roots, 1)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, ids(roots))
+	assert.Equal(t, 2, roots[0].Children[0].Children[0].Depth())
+	assert.Equal(t, "4", roots[0].Children[1].Message.Id)
+}
+
+// Test a missing parent joins its replies under a node without a message
+func TestThreadMissingParent(t *testing.T) {
+	roots := Thread([]TMessage{
+		{Id: "1", MessageId: "<b@x>", InReplyTo: "<a@x>", Date: 1},
+		{Id: "2", MessageId: "<c@x>", References: "<a@x>", Date: 2},
+		{Id: "3", MessageId: "<d@x>", References: "<z@x> <y@x>", Date: 3},
+	})
+	assert.Equal(t, []string{"-", "1", "2", "3"}, ids(roots))
+	assert.Equal(t, "<a@x>", roots[0].MessageId)
+	assert.Nil(t, roots[1].Parent)
+}
+
+// Test messages with the same subject but unrelated headers are not grouped
+func TestThreadNoSubjectGrouping(t *testing.T) {
+	roots := Thread([]TMessage{
+		{Id: "1", MessageId: "<a@x>", Subject: "Hello", Date: 1},
+		{Id: "2", MessageId: "<b@x>", Subject: "Re: Hello", Date: 2},
+	})
+	assert.Len(t, roots, 2)
+}
+
+// Test reference loops and duplicate Message-IDs do not break the tree
+func TestThreadLoopsAndDuplicates(t *testing.T) {
+	roots := Thread([]TMessage{
+		{Id: "1", MessageId: "<a@x>", References: "<b@x>", Date: 1},
+		{Id: "2", MessageId: "<b@x>", References: "<a@x>", Date: 2},
+		{Id: "3", MessageId: "<a@x>", Date: 3},
+		{Id: "4", MessageId: "<e@x>", References: "<e@x>", Date: 4},
+	})
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4"}, ids(roots))
+}
+
+func TestRender(t *testing.T) {
+	roots := Thread([]TMessage{
+		{Id: "1", MessageId: "<a@x>", Subject: "Plan", From: "alice", Date: 1},
+		{Id: "2", MessageId: "<b@x>", InReplyTo: "<a@x>", Subject: "Re: Plan", From: "bob", Date: 2},
+		{Id: "3", MessageId: "<c@x>", InReplyTo: "<b@x>", Subject: "Re: Plan", From: "alice", Date: 3},
+	})
+	require.Len(t, roots, 1)
+	marked := roots[0].Children[0]
+	assert.Equal(t, []string{
+		"  Plan (alice)",
+		"> └─ Re: Plan (bob)",
+		"     └─ Re: Plan (alice)",
+	}, Render(roots[0], marked))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"gmailexport/app/exporter"
+)
+
+// tVerifyCmd checks an export against its manifest
+type tVerifyCmd struct {
+	Args struct {
+		Manifest string `positional-arg-name:"MANIFEST" required:"yes" description:"manifest of the export (*.manifest.json), or a zip, tar.gz or tar.zst archive"`
+	} `positional-args:"yes"`
+}
+
+func (cmd *tVerifyCmd) Execute(args []string) error {
+	problems, err := exporter.Verify(cmd.Args.Manifest)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the export does not match its manifest")
+	}
+	fmt.Println("The export is complete and unmodified")
+	return nil
+}